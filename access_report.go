@@ -0,0 +1,180 @@
+package consulacl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Inventory holds the names of concrete consul objects
+type Inventory struct {
+	// Services holds the service names
+	Services []string
+	// Nodes holds the node names. Nodes are used for node, agent and session rules.
+	Nodes []string
+	// Keys holds the key/value store keys
+	Keys []string
+	// Queries holds the prepared query names
+	Queries []string
+}
+
+// LoadInventory retrieves an inventory using the given consul client
+//
+// Prepared queries without a name are skipped, as rules are matched against the query name.
+func LoadInventory(client *api.Client, q *api.QueryOptions) (*Inventory, error) {
+	inv := &Inventory{}
+
+	services, _, err := client.Catalog().Services(q)
+	if err != nil {
+		return nil, err
+	}
+	for service := range services {
+		inv.Services = append(inv.Services, service)
+	}
+	sort.Strings(inv.Services)
+
+	nodes, _, err := client.Catalog().Nodes(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		inv.Nodes = append(inv.Nodes, node.Node)
+	}
+	sort.Strings(inv.Nodes)
+
+	if inv.Keys, _, err = client.KV().Keys("", "", q); err != nil {
+		return nil, err
+	}
+	sort.Strings(inv.Keys)
+
+	queries, _, err := client.PreparedQuery().List(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range queries {
+		if query.Name != "" {
+			inv.Queries = append(inv.Queries, query.Name)
+		}
+	}
+	sort.Strings(inv.Queries)
+
+	return inv, nil
+}
+
+// AccessEntry describes the effective access to a single object
+type AccessEntry struct {
+	Resource Resource `json:"-"`
+	Target   string   `json:"target"`
+	Read     bool     `json:"read"`
+	Write    bool     `json:"write"`
+	List     bool     `json:"list"`
+	// Rule is the rule which decided the access, see Decision.Rule
+	Rule string `json:"rule"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (e AccessEntry) MarshalJSON() ([]byte, error) {
+	type plain AccessEntry
+	return json.Marshal(struct {
+		Resource string `json:"resource"`
+		plain
+	}{
+		Resource: e.Resource.String(),
+		plain:    plain(e),
+	})
+}
+
+// AccessReport holds the effective access of a policy to the objects of an inventory
+type AccessReport struct {
+	Entries []AccessEntry
+}
+
+// EffectiveAccess computes the effective access of the policy to every object of the inventory
+func (p *Policy) EffectiveAccess(inv *Inventory) *AccessReport {
+	report := &AccessReport{}
+
+	add := func(resource Resource, target string) {
+		d := p.Evaluate(resource, target, AccessRead)
+		report.Entries = append(report.Entries, AccessEntry{
+			Resource: resource,
+			Target:   target,
+			Read:     d.Allowed,
+			Write:    p.Allows(resource, target, AccessWrite),
+			List:     p.Allows(resource, target, AccessList),
+			Rule:     d.Rule(),
+		})
+	}
+
+	add(ResourceKeyring, "")
+	add(ResourceOperator, "")
+	for _, node := range inv.Nodes {
+		add(ResourceAgent, node)
+	}
+	for _, key := range inv.Keys {
+		add(ResourceKey, key)
+	}
+	for _, node := range inv.Nodes {
+		add(ResourceNode, node)
+	}
+	for _, query := range inv.Queries {
+		add(ResourceQuery, query)
+	}
+	for _, service := range inv.Services {
+		add(ResourceService, service)
+	}
+	for _, node := range inv.Nodes {
+		add(ResourceSession, node)
+	}
+
+	return report
+}
+
+// WriteText writes the report as an aligned text table
+func (r *AccessReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tTARGET\tREAD\tWRITE\tLIST\tRULE")
+	for _, e := range r.Entries {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%t\t%s\n", e.Resource.String(), e.Target, e.Read, e.Write, e.List, e.Rule)
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the report as CSV including a header row
+func (r *AccessReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"resource", "target", "read", "write", "list", "rule"}); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		record := []string{
+			e.Resource.String(),
+			e.Target,
+			strconv.FormatBool(e.Read),
+			strconv.FormatBool(e.Write),
+			strconv.FormatBool(e.List),
+			e.Rule,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the report entries as a JSON array
+func (r *AccessReport) WriteJSON(w io.Writer) error {
+	entries := r.Entries
+	if entries == nil {
+		entries = []AccessEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
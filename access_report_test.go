@@ -0,0 +1,139 @@
+package consulacl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadInventory(t *testing.T) {
+	responses := map[string]interface{}{
+		"/v1/catalog/services": map[string][]string{
+			"web": nil,
+			"db":  {"primary"},
+		},
+		"/v1/catalog/nodes": []*api.Node{
+			{Node: "node1"},
+			{Node: "node0"},
+		},
+		"/v1/kv/": []string{"app/config", "app/secret"},
+		"/v1/query": []*api.PreparedQueryDefinition{
+			{ID: "1", Name: "query0"},
+			{ID: "2"},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	t.Run("OK", func(t *testing.T) {
+		inv, err := LoadInventory(client, nil)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"db", "web"}, inv.Services)
+		assert.EqualValues(t, []string{"node0", "node1"}, inv.Nodes)
+		assert.EqualValues(t, []string{"app/config", "app/secret"}, inv.Keys)
+		assert.EqualValues(t, []string{"query0"}, inv.Queries)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		delete(responses, "/v1/query")
+		inv, err := LoadInventory(client, nil)
+		assert.Error(t, err)
+		assert.Nil(t, inv)
+	})
+}
+
+func TestPolicy_EffectiveAccess(t *testing.T) {
+	p := NewPolicy()
+	p.SetOperator(GrantRead)
+	p.Key().Set("app/", GrantList)
+	p.Service().Set("web", GrantWrite)
+
+	inv := &Inventory{
+		Services: []string{"web"},
+		Nodes:    []string{"node0"},
+		Keys:     []string{"app/config"},
+		Queries:  []string{"query0"},
+	}
+
+	report := p.EffectiveAccess(inv)
+	require.Len(t, report.Entries, 8)
+	assert.EqualValues(t, AccessEntry{
+		Resource: ResourceKeyring,
+		Rule:     "<default deny>",
+	}, report.Entries[0])
+	assert.EqualValues(t, AccessEntry{
+		Resource: ResourceOperator,
+		Read:     true,
+		List:     true,
+		Rule:     `operator = "read"`,
+	}, report.Entries[1])
+	assert.EqualValues(t, AccessEntry{
+		Resource: ResourceKey,
+		Target:   "app/config",
+		Read:     true,
+		List:     true,
+		Rule:     `key "app/" = "list"`,
+	}, report.Entries[3])
+	assert.EqualValues(t, AccessEntry{
+		Resource: ResourceService,
+		Target:   "web",
+		Read:     true,
+		Write:    true,
+		List:     true,
+		Rule:     `service "web" = "write"`,
+	}, report.Entries[6])
+
+	t.Run("Text", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteText(&buf))
+		assert.Contains(t, buf.String(), "RESOURCE  TARGET      READ   WRITE  LIST   RULE\n")
+		assert.Contains(t, buf.String(), "service   web         true   true   true   service \"web\" = \"write\"\n")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteCSV(&buf))
+		assert.Contains(t, buf.String(), "resource,target,read,write,list,rule\n")
+		assert.Contains(t, buf.String(), "key,app/config,true,false,true,\"key \"\"app/\"\" = \"\"list\"\"\"\n")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteJSON(&buf))
+
+		var entries []map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+		require.Len(t, entries, 8)
+		assert.EqualValues(t, map[string]interface{}{
+			"resource": "service",
+			"target":   "web",
+			"read":     true,
+			"write":    true,
+			"list":     true,
+			"rule":     `service "web" = "write"`,
+		}, entries[6])
+	})
+
+	t.Run("EmptyJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, (&AccessReport{}).WriteJSON(&buf))
+		assert.EqualValues(t, "[]\n", buf.String())
+	})
+}
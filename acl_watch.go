@@ -0,0 +1,207 @@
+package consulacl
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ACLEventType defines the type of an ACL event
+type ACLEventType uint8
+
+// String returns the string representation of an ACL event type
+func (t ACLEventType) String() string {
+	typeName, ok := aclEventTypeNameMap[t]
+	if !ok {
+		panic("invalid ACL event type")
+	}
+	return typeName
+}
+
+const (
+	// ACLCreated defines that a token has been created
+	ACLCreated ACLEventType = iota
+	// ACLUpdated defines that a token has been modified
+	ACLUpdated
+	// ACLDeleted defines that a token has been destroyed
+	ACLDeleted
+
+	aclEventTypeMax
+)
+
+var aclEventTypeNameMap = map[ACLEventType]string{
+	ACLCreated: "created",
+	ACLUpdated: "updated",
+	ACLDeleted: "deleted",
+}
+
+// ACLEvent describes a change of a token observed by an ACLWatcher
+type ACLEvent struct {
+	Type ACLEventType
+	// Entry is the current entry of the token, or the last known entry if the token has been deleted
+	Entry *api.ACLEntry
+	// Old is the last valid policy of the token, nil if the token has been created or its rules have never
+	// been valid
+	Old *Policy
+	// New is the current policy of the token, nil if the token has been deleted or its rules are invalid
+	New *Policy
+	// Changes holds the differences between the old and the new policy
+	Changes []RuleChange
+	// Err holds the error which occurred while parsing the rules of the token
+	Err error
+}
+
+const (
+	// DefaultACLWatcherMinBackoff defines the default delay before retrying after the first error
+	DefaultACLWatcherMinBackoff = time.Second
+	// DefaultACLWatcherMaxBackoff defines the default maximum delay before retrying after errors
+	DefaultACLWatcherMaxBackoff = time.Minute
+)
+
+// ACLWatcher watches the ACL tokens of a consul cluster using blocking queries
+type ACLWatcher struct {
+	// WaitTime limits how long a single blocking query waits for changes, zero uses the server default
+	WaitTime time.Duration
+	// MinBackoff defines the delay before retrying after the first error. It is doubled on every
+	// consecutive error up to MaxBackoff.
+	MinBackoff time.Duration
+	// MaxBackoff defines the maximum delay before retrying after errors
+	MaxBackoff time.Duration
+	// OnError is called for every error of a query, if set
+	OnError func(err error)
+
+	acl *api.ACL
+}
+
+// NewACLWatcher constructs a new watcher using the given ACL client
+func NewACLWatcher(acl *api.ACL) *ACLWatcher {
+	return &ACLWatcher{
+		MinBackoff: DefaultACLWatcherMinBackoff,
+		MaxBackoff: DefaultACLWatcherMaxBackoff,
+		acl:        acl,
+	}
+}
+
+type watchedACL struct {
+	entry  *api.ACLEntry
+	policy *Policy
+}
+
+// Run watches the tokens and sends an event for every change until the context is done
+//
+// Every token existing when the watcher starts is reported as created. Events of a single sync are
+// sent sorted by token ID. Run returns the error of the context.
+func (w *ACLWatcher) Run(ctx context.Context, events chan<- ACLEvent) error {
+	known := make(map[string]watchedACL)
+	var waitIndex uint64
+	backoff := time.Duration(0)
+
+	for {
+		q := &api.QueryOptions{WaitIndex: waitIndex, WaitTime: w.WaitTime}
+		entries, meta, err := w.acl.List(q.WithContext(ctx))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+			backoff = w.nextBackoff(backoff)
+			select {
+			case <-time.After(backoff):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		backoff = 0
+
+		// Reset the wait index if it went backwards, e.g. after a snapshot restore
+		if meta.LastIndex < waitIndex {
+			waitIndex = 0
+		} else {
+			waitIndex = meta.LastIndex
+		}
+
+		for _, event := range syncACLs(known, entries) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (w *ACLWatcher) nextBackoff(backoff time.Duration) time.Duration {
+	minBackoff, maxBackoff := w.MinBackoff, w.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultACLWatcherMinBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	if backoff == 0 {
+		return minBackoff
+	}
+	if backoff *= 2; backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// syncACLs updates the known tokens with the listed entries and returns the resulting events
+func syncACLs(known map[string]watchedACL, entries []*api.ACLEntry) []ACLEvent {
+	var events []ACLEvent
+	listed := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		listed[entry.ID] = true
+
+		previous, exists := known[entry.ID]
+		if exists && previous.entry.ModifyIndex == entry.ModifyIndex {
+			continue
+		}
+
+		event := ACLEvent{
+			Type:  ACLCreated,
+			Entry: entry,
+		}
+		if exists {
+			event.Type = ACLUpdated
+			event.Old = previous.policy
+		}
+		event.New, event.Err = NewPolicyFromRules(entry.Rules)
+
+		// Keep the last valid policy if the rules are invalid so later changes are diffed against it
+		policy := event.Old
+		if event.Err == nil {
+			event.Changes = Diff(event.Old, event.New)
+			policy = event.New
+		}
+
+		known[entry.ID] = watchedACL{entry: entry, policy: policy}
+		events = append(events, event)
+	}
+
+	for id, previous := range known {
+		if listed[id] {
+			continue
+		}
+		delete(known, id)
+		events = append(events, ACLEvent{
+			Type:    ACLDeleted,
+			Entry:   previous.entry,
+			Old:     previous.policy,
+			Changes: Diff(previous.policy, nil),
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Entry.ID < events[j].Entry.ID
+	})
+	return events
+}
@@ -0,0 +1,143 @@
+package consulacl_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveACLEvent(t *testing.T, events <-chan consulacl.ACLEvent) consulacl.ACLEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timeout waiting for event")
+	}
+	return consulacl.ACLEvent{}
+}
+
+func TestACLEventType_String(t *testing.T) {
+	for eventType := consulacl.ACLCreated; eventType < consulacl.ACLEventTypeMax; eventType++ {
+		assert.NotEmpty(t, eventType.String())
+	}
+	assert.Panics(t, func() {
+		_ = consulacl.ACLEventTypeMax.String()
+	})
+}
+
+func TestACLWatcher_Run(t *testing.T) {
+	server := newTestServer(&api.ACLEntry{ID: "a", Rules: `key "app/" { policy = "read" }`})
+	defer server.Close()
+	server.FailNext(2)
+
+	w := consulacl.NewACLWatcher(server.Client().ACL())
+	w.MinBackoff = 10 * time.Millisecond
+	var errCount int
+	w.OnError = func(err error) {
+		errCount++
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan consulacl.ACLEvent)
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, events)
+	}()
+
+	event := receiveACLEvent(t, events)
+	assert.EqualValues(t, consulacl.ACLCreated, event.Type)
+	assert.EqualValues(t, "a", event.Entry.ID)
+	assert.Nil(t, event.Old)
+	require.NotNil(t, event.New)
+	assert.EqualValues(t, []consulacl.RuleChange{{Resource: consulacl.ResourceKey, Target: "app/", New: consulacl.GrantRead}}, event.Changes)
+	assert.EqualValues(t, 2, errCount)
+
+	server.SetToken(&api.ACLEntry{ID: "a", Rules: `key "app/" { policy = "write" }`})
+	event = receiveACLEvent(t, events)
+	assert.EqualValues(t, consulacl.ACLUpdated, event.Type)
+	assert.EqualValues(t, consulacl.GrantRead, event.Old.Key().Get("app/"))
+	assert.EqualValues(t, []consulacl.RuleChange{{Resource: consulacl.ResourceKey, Target: "app/", Old: consulacl.GrantRead, New: consulacl.GrantWrite}}, event.Changes)
+
+	server.SetToken(&api.ACLEntry{ID: "b", Rules: `key "app/" {`})
+	event = receiveACLEvent(t, events)
+	assert.EqualValues(t, consulacl.ACLCreated, event.Type)
+	assert.EqualValues(t, "b", event.Entry.ID)
+	assert.Error(t, event.Err)
+	assert.Nil(t, event.New)
+
+	// Invalid rules keep the last valid policy as reference for later changes
+	server.SetToken(&api.ACLEntry{ID: "a", Rules: `key "app/" { policy = "wrte" }`})
+	event = receiveACLEvent(t, events)
+	assert.EqualValues(t, consulacl.ACLUpdated, event.Type)
+	assert.Error(t, event.Err)
+	assert.EqualValues(t, consulacl.GrantWrite, event.Old.Key().Get("app/"))
+	assert.Nil(t, event.New)
+	assert.Empty(t, event.Changes)
+
+	server.SetToken(&api.ACLEntry{ID: "a", Rules: `key "app/" { policy = "deny" }`})
+	event = receiveACLEvent(t, events)
+	assert.EqualValues(t, consulacl.ACLUpdated, event.Type)
+	assert.NoError(t, event.Err)
+	assert.EqualValues(t, consulacl.GrantWrite, event.Old.Key().Get("app/"))
+	assert.EqualValues(t, []consulacl.RuleChange{{Resource: consulacl.ResourceKey, Target: "app/", Old: consulacl.GrantWrite, New: consulacl.GrantDeny}}, event.Changes)
+
+	server.DeleteToken("a")
+	event = receiveACLEvent(t, events)
+	assert.EqualValues(t, consulacl.ACLDeleted, event.Type)
+	assert.EqualValues(t, "a", event.Entry.ID)
+	assert.Nil(t, event.New)
+	assert.EqualValues(t, []consulacl.RuleChange{{Resource: consulacl.ResourceKey, Target: "app/", Old: consulacl.GrantDeny}}, event.Changes)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.EqualError(t, err, context.Canceled.Error())
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "watcher did not stop")
+	}
+}
+
+func TestACLWatcher_nextBackoff(t *testing.T) {
+	w := &consulacl.ACLWatcher{MinBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	assert.EqualValues(t, time.Second, w.NextBackoff(0))
+	assert.EqualValues(t, 2*time.Second, w.NextBackoff(time.Second))
+	assert.EqualValues(t, 3*time.Second, w.NextBackoff(2*time.Second))
+
+	w = &consulacl.ACLWatcher{}
+	assert.EqualValues(t, consulacl.DefaultACLWatcherMinBackoff, w.NextBackoff(0))
+	assert.EqualValues(t, consulacl.DefaultACLWatcherMinBackoff, w.NextBackoff(consulacl.DefaultACLWatcherMinBackoff))
+}
+
+func TestACLWatcher_RunCancelDuringBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client, err := api.NewClient(&api.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	w := consulacl.NewACLWatcher(client.ACL())
+	w.MinBackoff = time.Hour
+	errs := make(chan error, 1)
+	w.OnError = func(err error) {
+		errs <- errors.New("failed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, make(chan consulacl.ACLEvent))
+	}()
+
+	<-errs
+	cancel()
+	assert.EqualError(t, <-done, context.Canceled.Error())
+}
@@ -0,0 +1,45 @@
+package consulacl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-atomic")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test")
+
+	t.Run("Create", func(t *testing.T) {
+		require.NoError(t, writeFileAtomic(file, []byte("first"), 0600))
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		assert.EqualValues(t, "first", string(data))
+
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.EqualValues(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		require.NoError(t, writeFileAtomic(file, []byte("second"), 0644))
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		assert.EqualValues(t, "second", string(data))
+
+		// No temporary files are left behind
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("MissingDir", func(t *testing.T) {
+		assert.Error(t, writeFileAtomic(filepath.Join(dir, "missing", "test"), nil, 0644))
+	})
+}
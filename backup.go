@@ -0,0 +1,253 @@
+package consulacl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// BackupVersion defines the version of the backup archive format written by Backup.Write
+const BackupVersion = 1
+
+// BackupToken holds a single token of a backup
+type BackupToken struct {
+	ID    string
+	Name  string
+	Type  string
+	Rules string
+	// Policy is the parsed policy of the token, nil if the rules are invalid
+	Policy *Policy
+}
+
+// checksum returns the checksum of the token
+func (t *BackupToken) checksum() string {
+	h := sha256.New()
+	for _, field := range []string{t.ID, t.Name, t.Type, t.Rules} {
+		io.WriteString(h, field)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Backup holds a snapshot of ACL tokens
+type Backup struct {
+	Created time.Time
+	// Tokens holds the tokens sorted by ID
+	Tokens []*BackupToken
+}
+
+// NewBackup constructs a new backup of the given ACL entries
+//
+// Tokens with invalid rules are included with their rules only.
+func NewBackup(entries []*api.ACLEntry) *Backup {
+	b := &Backup{
+		Created: time.Now().UTC(),
+	}
+	for _, entry := range entries {
+		token := &BackupToken{
+			ID:    entry.ID,
+			Name:  entry.Name,
+			Type:  entry.Type,
+			Rules: entry.Rules,
+		}
+		token.Policy, _ = NewPolicyFromRules(entry.Rules)
+		b.Tokens = append(b.Tokens, token)
+	}
+	sort.Slice(b.Tokens, func(i, j int) bool {
+		return b.Tokens[i].ID < b.Tokens[j].ID
+	})
+	return b
+}
+
+// CreateBackup creates a backup of all tokens using the given ACL client
+func CreateBackup(acl *api.ACL) (*Backup, error) {
+	entries, _, err := acl.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewBackup(entries), nil
+}
+
+// backupArchive is the JSON representation of a backup
+type backupArchive struct {
+	Version int                   `json:"version"`
+	Created time.Time             `json:"created"`
+	Tokens  []*backupArchiveToken `json:"tokens"`
+	// Checksum is the checksum of all token checksums
+	Checksum string `json:"checksum"`
+}
+
+type backupArchiveToken struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Rules string `json:"rules"`
+	// Policy holds the canonical rules of the parsed policy, nil if the rules are invalid
+	Policy   *string `json:"policy"`
+	Checksum string  `json:"checksum"`
+}
+
+func (a *backupArchive) checksum() string {
+	h := sha256.New()
+	for _, token := range a.Tokens {
+		io.WriteString(h, token.Checksum)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Write writes the backup as versioned JSON archive
+func (b *Backup) Write(w io.Writer) error {
+	archive := &backupArchive{
+		Version: BackupVersion,
+		Created: b.Created,
+		Tokens:  make([]*backupArchiveToken, 0, len(b.Tokens)),
+	}
+	for _, token := range b.Tokens {
+		archiveToken := &backupArchiveToken{
+			ID:       token.ID,
+			Name:     token.Name,
+			Type:     token.Type,
+			Rules:    token.Rules,
+			Checksum: token.checksum(),
+		}
+		if token.Policy != nil {
+			rules := token.Policy.GenerateRules()
+			archiveToken.Policy = &rules
+		}
+		archive.Tokens = append(archive.Tokens, archiveToken)
+	}
+	archive.Checksum = archive.checksum()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(archive)
+}
+
+// ReadBackup reads a backup archive written by Backup.Write
+//
+// The version and all checksums of the archive are verified. The policy of every token is parsed from its
+// rules again and has to match the policy stored in the archive.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	var archive backupArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, err
+	}
+	if archive.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", archive.Version)
+	}
+	if archive.checksum() != archive.Checksum {
+		return nil, fmt.Errorf("backup checksum mismatch")
+	}
+
+	b := &Backup{
+		Created: archive.Created,
+		Tokens:  make([]*BackupToken, 0, len(archive.Tokens)),
+	}
+	for _, archiveToken := range archive.Tokens {
+		token := &BackupToken{
+			ID:    archiveToken.ID,
+			Name:  archiveToken.Name,
+			Type:  archiveToken.Type,
+			Rules: archiveToken.Rules,
+		}
+		if token.checksum() != archiveToken.Checksum {
+			return nil, fmt.Errorf("token %q: checksum mismatch", token.ID)
+		}
+
+		p, err := NewPolicyFromRules(token.Rules)
+		if (err == nil) != (archiveToken.Policy != nil) {
+			return nil, fmt.Errorf("token %q: policy mismatch", token.ID)
+		}
+		if err == nil {
+			archived, err := NewPolicyFromRules(*archiveToken.Policy)
+			if err != nil || !archived.Equals(p) {
+				return nil, fmt.Errorf("token %q: policy mismatch", token.ID)
+			}
+			token.Policy = p
+		}
+		b.Tokens = append(b.Tokens, token)
+	}
+	return b, nil
+}
+
+// RestoreOptions configures Backup.Restore
+type RestoreOptions struct {
+	// Names restricts the restore to tokens with matching names, e.g. GlobMatcher("app-*"). A nil matcher
+	// restores all tokens.
+	Names Matcher
+	// DryRun reports the changes without applying them
+	DryRun bool
+}
+
+// RestoreReport describes the result of a restore
+type RestoreReport struct {
+	// Created holds the IDs of the recreated tokens
+	Created []string
+	// Updated holds the IDs of the updated tokens
+	Updated []string
+	// Unchanged holds the IDs of the tokens which already matched the backup
+	Unchanged []string
+	// Errors holds the errors of failed tokens by ID
+	Errors map[string]error
+}
+
+// Restore restores the tokens of the backup using the given ACL client
+//
+// Missing tokens are recreated with their original IDs, tokens which differ from the backup are updated.
+// Tokens not contained in the backup are left alone. Restoring continues after failures of single tokens,
+// errors are reported by the Errors field of the report.
+func (b *Backup) Restore(acl *api.ACL, opts RestoreOptions) (*RestoreReport, error) {
+	entries, _, err := acl.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]*api.ACLEntry, len(entries))
+	for _, entry := range entries {
+		live[entry.ID] = entry
+	}
+
+	report := &RestoreReport{
+		Errors: make(map[string]error),
+	}
+	for _, token := range b.Tokens {
+		if opts.Names != nil && !opts.Names.Match(token.Name) {
+			continue
+		}
+
+		entry := &api.ACLEntry{
+			ID:    token.ID,
+			Name:  token.Name,
+			Type:  token.Type,
+			Rules: token.Rules,
+		}
+
+		existing, exists := live[token.ID]
+		switch {
+		case !exists:
+			if !opts.DryRun {
+				if _, _, err := acl.Create(entry, nil); err != nil {
+					report.Errors[token.ID] = err
+					continue
+				}
+			}
+			report.Created = append(report.Created, token.ID)
+		case existing.Name != token.Name || existing.Type != token.Type || existing.Rules != token.Rules:
+			if !opts.DryRun {
+				if _, err := acl.Update(entry, nil); err != nil {
+					report.Errors[token.ID] = err
+					continue
+				}
+			}
+			report.Updated = append(report.Updated, token.ID)
+		default:
+			report.Unchanged = append(report.Unchanged, token.ID)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,152 @@
+package consulacl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBackupEntries() []*api.ACLEntry {
+	return []*api.ACLEntry{
+		{ID: "2", Name: "app-web", Type: "client", Rules: `service "web" { policy = "write" }`},
+		{ID: "1", Name: "app-db", Type: "client", Rules: `service "db" { policy = "write" }`},
+		{ID: "3", Name: "broken", Type: "client", Rules: `service "web" {`},
+	}
+}
+
+func TestNewBackup(t *testing.T) {
+	b := consulacl.NewBackup(testBackupEntries())
+	require.Len(t, b.Tokens, 3)
+	assert.EqualValues(t, "1", b.Tokens[0].ID)
+	assert.EqualValues(t, "app-db", b.Tokens[0].Name)
+	assert.EqualValues(t, consulacl.GrantWrite, b.Tokens[0].Policy.Service().Get("db"))
+	assert.EqualValues(t, "3", b.Tokens[2].ID)
+	assert.Nil(t, b.Tokens[2].Policy)
+	assert.False(t, b.Created.IsZero())
+}
+
+func TestBackup_WriteRead(t *testing.T) {
+	b := consulacl.NewBackup(testBackupEntries())
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Write(&buf))
+	archive := buf.String()
+
+	read, err := consulacl.ReadBackup(strings.NewReader(archive))
+	require.NoError(t, err)
+	assert.True(t, b.Created.Equal(read.Created))
+	require.Len(t, read.Tokens, 3)
+	for i, token := range b.Tokens {
+		assert.EqualValues(t, token.ID, read.Tokens[i].ID)
+		assert.EqualValues(t, token.Name, read.Tokens[i].Name)
+		assert.EqualValues(t, token.Type, read.Tokens[i].Type)
+		assert.EqualValues(t, token.Rules, read.Tokens[i].Rules)
+		if token.Policy == nil {
+			assert.Nil(t, read.Tokens[i].Policy)
+		} else {
+			assert.True(t, token.Policy.Equals(read.Tokens[i].Policy))
+		}
+	}
+
+	modify := func(fn func(archive map[string]interface{})) string {
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(archive), &decoded))
+		fn(decoded)
+		data, err := json.Marshal(decoded)
+		require.NoError(t, err)
+		return string(data)
+	}
+	token := func(archive map[string]interface{}) map[string]interface{} {
+		return archive["tokens"].([]interface{})[0].(map[string]interface{})
+	}
+
+	t.Run("Version", func(t *testing.T) {
+		_, err := consulacl.ReadBackup(strings.NewReader(modify(func(archive map[string]interface{}) {
+			archive["version"] = 2
+		})))
+		assert.EqualError(t, err, "unsupported backup version 2")
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		_, err := consulacl.ReadBackup(strings.NewReader(modify(func(archive map[string]interface{}) {
+			archive["tokens"] = archive["tokens"].([]interface{})[1:]
+		})))
+		assert.EqualError(t, err, "backup checksum mismatch")
+	})
+
+	t.Run("TokenChecksum", func(t *testing.T) {
+		_, err := consulacl.ReadBackup(strings.NewReader(modify(func(archive map[string]interface{}) {
+			token(archive)["rules"] = `operator = "write"`
+		})))
+		assert.EqualError(t, err, `token "1": checksum mismatch`)
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+		_, err := consulacl.ReadBackup(strings.NewReader(modify(func(archive map[string]interface{}) {
+			token(archive)["policy"] = `operator = "write"`
+		})))
+		assert.EqualError(t, err, `token "1": policy mismatch`)
+
+		_, err = consulacl.ReadBackup(strings.NewReader(modify(func(archive map[string]interface{}) {
+			token(archive)["policy"] = nil
+		})))
+		assert.EqualError(t, err, `token "1": policy mismatch`)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := consulacl.ReadBackup(strings.NewReader("{"))
+		assert.Error(t, err)
+	})
+}
+
+func TestBackup_Restore(t *testing.T) {
+	server := newTestServer(testBackupEntries()...)
+	defer server.Close()
+	acl := server.Client().ACL()
+
+	b, err := consulacl.CreateBackup(acl)
+	require.NoError(t, err)
+	require.Len(t, b.Tokens, 3)
+
+	// Break the live state
+	server.DeleteToken("1")
+	server.SetToken(&api.ACLEntry{ID: "2", Name: "app-web", Rules: `operator = "write"`})
+	server.SetToken(&api.ACLEntry{ID: "4", Name: "other"})
+
+	t.Run("DryRun", func(t *testing.T) {
+		report, err := b.Restore(acl, consulacl.RestoreOptions{DryRun: true})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"1"}, report.Created)
+		assert.EqualValues(t, []string{"2"}, report.Updated)
+		assert.EqualValues(t, []string{"3"}, report.Unchanged)
+		assert.Empty(t, report.Errors)
+		assert.Len(t, server.Tokens(), 3)
+	})
+
+	t.Run("Selective", func(t *testing.T) {
+		report, err := b.Restore(acl, consulacl.RestoreOptions{Names: consulacl.GlobMatcher("*-db")})
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"1"}, report.Created)
+		assert.Empty(t, report.Updated)
+		assert.Empty(t, report.Unchanged)
+		assert.EqualValues(t, `service "db" { policy = "write" }`, server.Token("1").Rules)
+		assert.EqualValues(t, `operator = "write"`, server.Token("2").Rules)
+	})
+
+	t.Run("All", func(t *testing.T) {
+		report, err := b.Restore(acl, consulacl.RestoreOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, report.Created)
+		assert.EqualValues(t, []string{"2"}, report.Updated)
+		assert.EqualValues(t, []string{"1", "3"}, report.Unchanged)
+		assert.EqualValues(t, `service "web" { policy = "write" }`, server.Token("2").Rules)
+		// Tokens missing from the backup are left alone
+		assert.NotNil(t, server.Token("4"))
+	})
+}
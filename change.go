@@ -0,0 +1,152 @@
+package consulacl
+
+// ChangeType defines the type of a change
+type ChangeType uint8
+
+// String returns the string representation of a change type
+func (t ChangeType) String() string {
+	typeName, ok := changeTypeNameMap[t]
+	if !ok {
+		panic("invalid change type")
+	}
+	return typeName
+}
+
+const (
+	// ChangeSet defines that the grant for a target was set
+	ChangeSet ChangeType = iota
+	// ChangeRemove defines that the grant for a target was removed
+	ChangeRemove
+	// ChangeKeyring defines that the keyring grant was set
+	ChangeKeyring
+	// ChangeOperator defines that the operator grant was set
+	ChangeOperator
+
+	changeTypeMax
+)
+
+var changeTypeNameMap = map[ChangeType]string{
+	ChangeSet:      "set",
+	ChangeRemove:   "remove",
+	ChangeKeyring:  "keyring",
+	ChangeOperator: "operator",
+}
+
+// GrantChange describes a single change of a GrantMap
+type GrantChange struct {
+	// Type is either ChangeSet or ChangeRemove
+	Type   ChangeType
+	Target string
+	Old    Grant
+	New    Grant
+}
+
+// Change describes a single change of a policy
+type Change struct {
+	Type     ChangeType
+	Resource Resource
+	// Target is the changed target. It is empty for keyring and operator changes.
+	Target string
+	Old    Grant
+	New    Grant
+}
+
+type grantObserver struct {
+	id uint64
+	fn func(GrantChange)
+}
+
+type policyObserver struct {
+	id uint64
+	fn func(Change)
+}
+
+// OnChange registers a function which is called for every change of the GrantMap
+//
+// Only actual changes are reported, e.g. setting a target to its current grant is not. The function is
+// called after the change has been applied, without holding the lock of the GrantMap, so it may access the
+// GrantMap itself. Changes applied concurrently may be reported out of order.
+//
+// The returned function unregisters the observer.
+func (gm *GrantMap) OnChange(fn func(GrantChange)) func() {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	gm.nextObserverID++
+	id := gm.nextObserverID
+	gm.observers = append(gm.observers, grantObserver{id: id, fn: fn})
+
+	return func() {
+		gm.mu.Lock()
+		defer gm.mu.Unlock()
+
+		observers := make([]grantObserver, 0, len(gm.observers))
+		for _, observer := range gm.observers {
+			if observer.id != id {
+				observers = append(observers, observer)
+			}
+		}
+		gm.observers = observers
+	}
+}
+
+// notifyGrantObservers calls all observers with the given change
+//
+// The observers have to be retrieved while holding the lock, notify must be called without it.
+func notifyGrantObservers(observers []grantObserver, change GrantChange) {
+	for _, observer := range observers {
+		observer.fn(change)
+	}
+}
+
+// OnChange registers a function which is called for every change of the policy
+//
+// This includes changes of all GrantMaps as well as the keyring and operator grants. See GrantMap.OnChange
+// for the delivery semantics.
+//
+// The returned function unregisters the observer.
+func (p *Policy) OnChange(fn func(Change)) func() {
+	var cancels []func()
+
+	for _, resource := range TargetResources {
+		resource := resource
+		cancels = append(cancels, p.grantMap(resource).OnChange(func(c GrantChange) {
+			fn(Change{
+				Type:     c.Type,
+				Resource: resource,
+				Target:   c.Target,
+				Old:      c.Old,
+				New:      c.New,
+			})
+		}))
+	}
+
+	p.mu.Lock()
+	p.nextObserverID++
+	id := p.nextObserverID
+	p.observers = append(p.observers, policyObserver{id: id, fn: fn})
+	p.mu.Unlock()
+
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		observers := make([]policyObserver, 0, len(p.observers))
+		for _, observer := range p.observers {
+			if observer.id != id {
+				observers = append(observers, observer)
+			}
+		}
+		p.observers = observers
+	}
+}
+
+func notifyPolicyObservers(observers []policyObserver, change Change) {
+	for _, observer := range observers {
+		observer.fn(change)
+	}
+}
@@ -0,0 +1,93 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeType_String(t *testing.T) {
+	t.Run("ValidChangeTypes", func(t *testing.T) {
+		for c, typeName := range changeTypeNameMap {
+			assert.EqualValues(t, typeName, c.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.PanicsWithValue(t, "invalid change type", func() {
+			_ = changeTypeMax.String()
+		})
+	})
+}
+
+func TestGrantMap_OnChange(t *testing.T) {
+	gm := &GrantMap{}
+
+	var changes []GrantChange
+	cancel := gm.OnChange(func(c GrantChange) {
+		// Ensure the lock is not held while notifying
+		gm.Get(c.Target)
+		changes = append(changes, c)
+	})
+
+	gm.Set("test0", GrantRead)
+	gm.Set("test0", GrantRead)
+	gm.Set("test0", GrantWrite)
+	gm.Remove("test1")
+	gm.Set("test0", GrantNone)
+
+	assert.EqualValues(t, []GrantChange{
+		{Type: ChangeSet, Target: "test0", Old: GrantNone, New: GrantRead},
+		{Type: ChangeSet, Target: "test0", Old: GrantRead, New: GrantWrite},
+		{Type: ChangeRemove, Target: "test0", Old: GrantWrite, New: GrantNone},
+	}, changes)
+
+	// Ensure clones do not inherit observers
+	gm.Clone().Set("test0", GrantRead)
+	assert.Len(t, changes, 3)
+
+	cancel()
+	gm.Set("test0", GrantRead)
+	assert.Len(t, changes, 3)
+}
+
+func TestPolicy_OnChange(t *testing.T) {
+	p := NewPolicy()
+
+	var changes, otherChanges []Change
+	cancel := p.OnChange(func(c Change) {
+		changes = append(changes, c)
+	})
+	cancelOther := p.OnChange(func(c Change) {
+		otherChanges = append(otherChanges, c)
+	})
+
+	p.SetKeyring(GrantRead)
+	p.SetKeyring(GrantRead)
+	p.SetOperator(GrantWrite)
+	p.Key().Set("app/", GrantWrite)
+	p.Service().Set("web", GrantRead)
+	p.Service().Remove("web")
+	p.SetGrant(ResourceSession, "node0", GrantDeny)
+
+	expected := []Change{
+		{Type: ChangeKeyring, Resource: ResourceKeyring, Old: GrantNone, New: GrantRead},
+		{Type: ChangeOperator, Resource: ResourceOperator, Old: GrantNone, New: GrantWrite},
+		{Type: ChangeSet, Resource: ResourceKey, Target: "app/", Old: GrantNone, New: GrantWrite},
+		{Type: ChangeSet, Resource: ResourceService, Target: "web", Old: GrantNone, New: GrantRead},
+		{Type: ChangeRemove, Resource: ResourceService, Target: "web", Old: GrantRead, New: GrantNone},
+		{Type: ChangeSet, Resource: ResourceSession, Target: "node0", Old: GrantNone, New: GrantDeny},
+	}
+	assert.EqualValues(t, expected, changes)
+	assert.EqualValues(t, expected, otherChanges)
+
+	cancel()
+	p.SetKeyring(GrantWrite)
+	p.Key().Set("app/", GrantRead)
+	assert.Len(t, changes, len(expected))
+	assert.Len(t, otherChanges, len(expected)+2)
+
+	cancelOther()
+	p.SetOperator(GrantRead)
+	assert.Len(t, otherChanges, len(expected)+2)
+}
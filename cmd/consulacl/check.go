@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/anexia-it/consulacl"
+)
+
+// runCheck checks a directory of policies against constraints
+//
+// Violations are written to stdout grouped by policy. The command exits with code 2 if any policy
+// violates a constraint.
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", "", "directory of policy rule files")
+	constraintsFile := fs.String("constraints", "", "constraint file in HCL, JSON or YAML format (by .yaml or .yml extension)")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if *dir == "" || *constraintsFile == "" {
+		fmt.Fprintln(stderr, "-dir and -constraints are required")
+		return 1
+	}
+
+	s, err := consulacl.NewPolicySetFromDir(*dir)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	constraints, err := consulacl.LoadConstraintsFile(*constraintsFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	violations := constraints.CheckSet(s)
+	count := 0
+	for _, name := range s.Names() {
+		for _, violation := range violations[name] {
+			fmt.Fprintln(stdout, violation.String())
+			count++
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d policies checked, %d violations\n", s.Len(), count)
+	if count > 0 {
+		return 2
+	}
+	return 0
+}
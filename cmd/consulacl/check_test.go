@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-check")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	policies := filepath.Join(dir, "policies")
+	require.NoError(t, os.Mkdir(policies, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(policies, "ops-admin.hcl"), []byte(`operator = "write"`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(policies, "web.hcl"), []byte(`operator = "write"`), 0644))
+
+	constraints := filepath.Join(dir, "constraints.hcl")
+	require.NoError(t, ioutil.WriteFile(constraints, []byte(`
+constraint "operator-write" {
+  resource = "operator"
+  max_grant = "read"
+  except = ["ops-*"]
+}
+`), 0644))
+
+	t.Run("Violations", func(t *testing.T) {
+		var stdout bytes.Buffer
+		assert.EqualValues(t, 2, run([]string{"check", "-dir", policies, "-constraints", constraints}, &stdout, &bytes.Buffer{}))
+		assert.EqualValues(t, `web: operator = "write" violates operator-write: grant exceeds "read"`+"\n2 policies checked, 1 violations\n", stdout.String())
+	})
+
+	t.Run("Passed", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(policies, "web.hcl"), []byte(`operator = "read"`), 0644))
+		var stdout bytes.Buffer
+		assert.EqualValues(t, 0, run([]string{"check", "-dir", policies, "-constraints", constraints}, &stdout, &bytes.Buffer{}))
+		assert.EqualValues(t, "2 policies checked, 0 violations\n", stdout.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var stderr bytes.Buffer
+		assert.EqualValues(t, 1, run([]string{"check", "-dir", policies}, &bytes.Buffer{}, &stderr))
+		assert.Contains(t, stderr.String(), "-dir and -constraints are required")
+
+		assert.EqualValues(t, 1, run([]string{"check", "-dir", filepath.Join(dir, "missing"), "-constraints", constraints}, &bytes.Buffer{}, &bytes.Buffer{}))
+		assert.EqualValues(t, 1, run([]string{"check", "-dir", policies, "-constraints", filepath.Join(dir, "missing.hcl")}, &bytes.Buffer{}, &bytes.Buffer{}))
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+)
+
+// runDrift compares a directory of desired policies against the live tokens
+//
+// Drift events are written to stdout as JSON lines. With -once the command exits with code 2 if
+// unremediated drift of a desired policy has been detected, unmanaged tokens are only reported.
+func runDrift(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var cf clientFlags
+	cf.register(fs)
+	dir := fs.String("dir", "", "directory of desired policy rule files")
+	key := fs.String("key", "name", "token attribute matched against policy names, name or id")
+	interval := fs.Duration("interval", consulacl.DefaultReconcilerInterval, "interval between two syncs")
+	remediate := fs.Bool("remediate", false, "update modified and create missing tokens")
+	once := fs.Bool("once", false, "sync once and exit")
+	metricsAddr := fs.String("metrics-addr", "", "address to serve metrics at, e.g. :9400")
+	constraintsFile := fs.String("constraints", "", "constraint file, violating policies are never remediated")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if *dir == "" {
+		fmt.Fprintln(stderr, "-dir is required")
+		return 1
+	}
+
+	var keyFunc consulacl.ACLEntryKeyFunc
+	switch *key {
+	case "name":
+		keyFunc = consulacl.ACLEntryName
+	case "id":
+		keyFunc = consulacl.ACLEntryID
+	default:
+		fmt.Fprintf(stderr, "invalid key %q\n", *key)
+		return 1
+	}
+
+	desired, err := consulacl.NewPolicySetFromDir(*dir)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var constraints consulacl.Constraints
+	if *constraintsFile != "" {
+		if constraints, err = consulacl.LoadConstraintsFile(*constraintsFile); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	client, err := cf.client()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	r := consulacl.NewReconciler(client.ACL(), desired)
+	r.Interval = *interval
+	r.Key = keyFunc
+	r.Remediate = *remediate
+	r.Constraints = constraints
+
+	encoder := json.NewEncoder(stdout)
+	if *once {
+		events, err := r.Sync()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		code := 0
+		for _, event := range events {
+			encoder.Encode(event)
+			if !event.Remediated && event.Type != consulacl.DriftUnmanaged {
+				code = 2
+			}
+		}
+		return code
+	}
+
+	r.OnDrift = func(event consulacl.DriftEvent) {
+		encoder.Encode(event)
+	}
+	r.OnError = func(err error) {
+		fmt.Fprintf(stderr, "%s sync failed: %v\n", time.Now().Format(time.RFC3339), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// A failing metrics listener stops the reconciler
+	serveErr := make(chan error, 1)
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", r)
+		server := &http.Server{Addr: *metricsAddr, Handler: mux}
+		defer server.Close()
+		go func() {
+			serveErr <- server.ListenAndServe()
+			cancel()
+		}()
+	}
+
+	err = r.Run(ctx)
+	select {
+	case err := <-serveErr:
+		fmt.Fprintln(stderr, err)
+		return 1
+	default:
+	}
+	if err != nil && err != context.Canceled {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anexia-it/consulacl/consulacltest"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-drift")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "web.hcl"), []byte(`service "web" { policy = "write" }`), 0644))
+
+	server := consulacltest.NewServer()
+	defer server.Close()
+	server.SetToken(&api.ACLEntry{ID: "1", Name: "web", Rules: `service "web" { policy = "read" }`})
+
+	t.Run("Drift", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"drift", "-once", "-http-addr", server.URL, "-dir", dir}, &stdout, &stderr)
+		assert.EqualValues(t, 2, code, stderr.String())
+
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &event))
+		assert.EqualValues(t, "modified", event["type"])
+		assert.EqualValues(t, "web", event["name"])
+	})
+
+	t.Run("KeyByID", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"drift", "-once", "-http-addr", server.URL, "-dir", dir, "-key", "id"}, &stdout, &stderr)
+		// Matched by ID the token is unmanaged and the desired policy is missing
+		assert.EqualValues(t, 2, code, stderr.String())
+		assert.EqualValues(t, 2, bytes.Count(stdout.Bytes(), []byte("\n")))
+	})
+
+	t.Run("Unmanaged", func(t *testing.T) {
+		server.SetToken(&api.ACLEntry{ID: "2", Name: "legacy", Rules: `key "" { policy = "read" }`})
+		defer server.DeleteToken("2")
+
+		// Unmanaged tokens are reported, but do not fail the sync once the desired policies are in place
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"drift", "-once", "-remediate", "-http-addr", server.URL, "-dir", dir}, &stdout, &stderr)
+		assert.EqualValues(t, 0, code, stderr.String())
+		assert.Contains(t, stdout.String(), `"type":"unmanaged"`)
+		assert.Contains(t, stdout.String(), `"type":"modified"`)
+
+		stdout.Reset()
+		code = run([]string{"drift", "-once", "-http-addr", server.URL, "-dir", dir}, &stdout, &stderr)
+		assert.EqualValues(t, 0, code, stderr.String())
+		assert.EqualValues(t, 1, bytes.Count(stdout.Bytes(), []byte("\n")))
+
+		server.SetToken(&api.ACLEntry{ID: "1", Name: "web", Rules: `service "web" { policy = "read" }`})
+	})
+
+	t.Run("MetricsListenerError", func(t *testing.T) {
+		var stderr bytes.Buffer
+		code := run([]string{"drift", "-http-addr", server.URL, "-dir", dir, "-metrics-addr", "invalid:address"}, &bytes.Buffer{}, &stderr)
+		assert.EqualValues(t, 1, code)
+		assert.Contains(t, stderr.String(), "listen tcp")
+	})
+
+	t.Run("Constraints", func(t *testing.T) {
+		constraints := filepath.Join(dir, "constraints.json")
+		require.NoError(t, ioutil.WriteFile(constraints, []byte(`{"constraint": {"service-read": {"resource": "service", "max_grant": "read"}}}`), 0644))
+		defer os.Remove(constraints)
+
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"drift", "-once", "-remediate", "-http-addr", server.URL, "-dir", dir, "-constraints", constraints}, &stdout, &stderr)
+		assert.EqualValues(t, 2, code, stderr.String())
+		assert.Contains(t, stdout.String(), `"violations":[`)
+		assert.EqualValues(t, `service "web" { policy = "read" }`, server.Token("1").Rules)
+
+		assert.EqualValues(t, 1, run([]string{"drift", "-once", "-dir", dir, "-constraints", filepath.Join(dir, "missing.hcl")}, &bytes.Buffer{}, &bytes.Buffer{}))
+	})
+
+	t.Run("InvalidFlags", func(t *testing.T) {
+		var stderr bytes.Buffer
+		assert.EqualValues(t, 1, run([]string{"drift"}, &bytes.Buffer{}, &stderr))
+		assert.Contains(t, stderr.String(), "-dir is required")
+
+		stderr.Reset()
+		assert.EqualValues(t, 1, run([]string{"drift", "-dir", dir, "-key", "other"}, &bytes.Buffer{}, &stderr))
+		assert.Contains(t, stderr.String(), `invalid key "other"`)
+
+		stderr.Reset()
+		assert.EqualValues(t, 1, run([]string{"drift", "-dir", filepath.Join(dir, "missing")}, &bytes.Buffer{}, &stderr))
+	})
+}
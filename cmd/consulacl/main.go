@@ -0,0 +1,85 @@
+// Command consulacl provides tools for managing consul ACL tokens based on the consulacl library
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// command defines the function type of subcommands
+//
+// The function returns the exit code of the command.
+type command func(args []string, stdout, stderr io.Writer) int
+
+var commands = map[string]command{
+	"check": runCheck,
+	"drift": runDrift,
+	"test":  runTest,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 1
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage(stderr)
+		return 1
+	}
+	return cmd(args[1:], stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "usage: consulacl <command> [flags]")
+	fmt.Fprintln(w, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", name)
+	}
+}
+
+// clientFlags holds the flags used to connect to consul
+//
+// Unset flags fall back to the CONSUL_HTTP_* environment variables.
+type clientFlags struct {
+	address    string
+	token      string
+	datacenter string
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.address, "http-addr", "", "address of the consul agent")
+	fs.StringVar(&f.token, "token", "", "ACL token to use")
+	fs.StringVar(&f.datacenter, "datacenter", "", "datacenter to use")
+}
+
+func (f *clientFlags) client() (*api.Client, error) {
+	config := api.DefaultConfig()
+	if f.address != "" {
+		config.Address = f.address
+	}
+	if f.token != "" {
+		config.Token = f.token
+	}
+	if f.datacenter != "" {
+		config.Datacenter = f.datacenter
+	}
+	return api.NewClient(config)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("NoCommand", func(t *testing.T) {
+		var stderr bytes.Buffer
+		assert.EqualValues(t, 1, run(nil, &bytes.Buffer{}, &stderr))
+		assert.Contains(t, stderr.String(), "usage: consulacl")
+		assert.Contains(t, stderr.String(), "  drift\n")
+	})
+
+	t.Run("UnknownCommand", func(t *testing.T) {
+		var stderr bytes.Buffer
+		assert.EqualValues(t, 1, run([]string{"unknown"}, &bytes.Buffer{}, &stderr))
+		assert.Contains(t, stderr.String(), `unknown command "unknown"`)
+	})
+}
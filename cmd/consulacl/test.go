@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/anexia-it/consulacl"
+)
+
+// runTest runs test case files against a policy rule file
+//
+// Failed cases are written to stdout with an explanation, passed cases only with -v. The command exits
+// with code 2 if any case failed and with code 1 on invalid arguments or files.
+func runTest(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	rules := fs.String("rules", "", "policy rule file to test")
+	verbose := fs.Bool("v", false, "report passed cases as well")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if *rules == "" || fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: consulacl test -rules <file> <cases file>...")
+		return 1
+	}
+
+	data, err := ioutil.ReadFile(*rules)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	p, err := consulacl.NewPolicyFromRules(string(data))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *rules, err)
+		return 1
+	}
+
+	var passed, failed int
+	for _, file := range fs.Args() {
+		cases, err := consulacl.LoadTestCasesFile(file)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		for _, result := range p.RunTestCases(cases) {
+			if result.Passed {
+				passed++
+				if *verbose {
+					fmt.Fprintf(stdout, "PASS %s: %s\n", file, result.Explanation())
+				}
+				continue
+			}
+			failed++
+			fmt.Fprintf(stdout, "FAIL %s: %s\n", file, result.Explanation())
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 2
+	}
+	return 0
+}
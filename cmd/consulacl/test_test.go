@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rules := filepath.Join(dir, "app.hcl")
+	require.NoError(t, ioutil.WriteFile(rules, []byte(`key "app/" { policy = "write" }`), 0644))
+	passing := filepath.Join(dir, "passing.json")
+	require.NoError(t, ioutil.WriteFile(passing, []byte(`[{"resource": "key", "target": "app/db", "access": "write", "expect": "allow"}]`), 0644))
+	failing := filepath.Join(dir, "failing.json")
+	require.NoError(t, ioutil.WriteFile(failing, []byte(`[{"resource": "key", "target": "app/db", "access": "write", "expect": "deny"}]`), 0644))
+
+	t.Run("Passed", func(t *testing.T) {
+		var stdout bytes.Buffer
+		assert.EqualValues(t, 0, run([]string{"test", "-rules", rules, passing}, &stdout, &bytes.Buffer{}))
+		assert.EqualValues(t, "1 passed, 0 failed\n", stdout.String())
+
+		stdout.Reset()
+		assert.EqualValues(t, 0, run([]string{"test", "-v", "-rules", rules, passing}, &stdout, &bytes.Buffer{}))
+		assert.Contains(t, stdout.String(), "PASS "+passing+`: key "app/db" write: allow by key "app/" = "write"`)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		var stdout bytes.Buffer
+		assert.EqualValues(t, 2, run([]string{"test", "-rules", rules, passing, failing}, &stdout, &bytes.Buffer{}))
+		assert.EqualValues(t, "FAIL "+failing+`: key "app/db" write: expected deny, got allow by key "app/" = "write"`+"\n1 passed, 1 failed\n", stdout.String())
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		cases := filepath.Join(dir, "cases.yaml")
+		require.NoError(t, ioutil.WriteFile(cases, []byte("- {resource: key, target: other/, access: read, expect: deny}\n"), 0644))
+
+		var stdout bytes.Buffer
+		assert.EqualValues(t, 0, run([]string{"test", "-rules", rules, cases}, &stdout, &bytes.Buffer{}))
+		assert.EqualValues(t, "1 passed, 0 failed\n", stdout.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var stderr bytes.Buffer
+		assert.EqualValues(t, 1, run([]string{"test", "-rules", rules}, &bytes.Buffer{}, &stderr))
+		assert.Contains(t, stderr.String(), "usage: consulacl test")
+
+		assert.EqualValues(t, 1, run([]string{"test", "-rules", filepath.Join(dir, "missing.hcl"), passing}, &bytes.Buffer{}, &bytes.Buffer{}))
+		assert.EqualValues(t, 1, run([]string{"test", "-rules", passing, passing}, &bytes.Buffer{}, &bytes.Buffer{}))
+		assert.EqualValues(t, 1, run([]string{"test", "-rules", rules, rules}, &bytes.Buffer{}, &bytes.Buffer{}))
+	})
+}
@@ -0,0 +1,105 @@
+package consulacl
+
+import (
+	"sync/atomic"
+
+	"github.com/armon/go-radix"
+)
+
+// CompiledPolicy is an immutable snapshot of a policy optimized for lookups
+//
+// A CompiledPolicy is safe for concurrent use without any locking. A nil CompiledPolicy denies all requests.
+type CompiledPolicy struct {
+	trees    map[Resource]*radix.Tree
+	keyring  Grant
+	operator Grant
+}
+
+// Compile creates an immutable snapshot of the policy optimized for lookups
+//
+// Changes to the policy after compilation are not reflected by the snapshot.
+func (p *Policy) Compile() *CompiledPolicy {
+	c := &CompiledPolicy{
+		trees: make(map[Resource]*radix.Tree, len(TargetResources)),
+	}
+
+	for _, resource := range TargetResources {
+		c.trees[resource] = radix.New()
+	}
+
+	Walk(p, VisitorFunc(func(rule Rule) {
+		switch rule.Resource {
+		case ResourceKeyring:
+			c.keyring = rule.Grant
+		case ResourceOperator:
+			c.operator = rule.Grant
+		default:
+			c.trees[rule.Resource].Insert(rule.Target, rule.Grant)
+		}
+	}))
+
+	return c
+}
+
+// Evaluate decides whether the compiled policy allows the given access to a target of a resource
+//
+// See Policy.Evaluate for the evaluation semantics.
+func (c *CompiledPolicy) Evaluate(resource Resource, target string, access Access) Decision {
+	d := Decision{
+		Resource: resource,
+		Target:   target,
+		Access:   access,
+	}
+	if c == nil {
+		return d
+	}
+
+	switch resource {
+	case ResourceKeyring:
+		d.Grant = c.keyring
+		d.Matched = d.Grant != GrantNone
+	case ResourceOperator:
+		d.Grant = c.operator
+		d.Matched = d.Grant != GrantNone
+	default:
+		if tree, exists := c.trees[resource]; exists {
+			var grant interface{}
+			if d.Prefix, grant, d.Matched = tree.LongestPrefix(target); d.Matched {
+				d.Grant = grant.(Grant)
+			}
+		}
+	}
+
+	return d.decide()
+}
+
+// Allows checks if the compiled policy allows the given access to a target of a resource
+func (c *CompiledPolicy) Allows(resource Resource, target string, access Access) bool {
+	return c.Evaluate(resource, target, access).Allowed
+}
+
+// CompiledPolicyHolder holds a compiled policy which can be replaced atomically
+//
+// Readers are never blocked by replacing the policy, e.g. on policy reloads. The zero value holds a nil
+// CompiledPolicy, denying all requests.
+type CompiledPolicyHolder struct {
+	v atomic.Value
+}
+
+// NewCompiledPolicyHolder constructs a new holder for the given compiled policy
+func NewCompiledPolicyHolder(c *CompiledPolicy) *CompiledPolicyHolder {
+	h := &CompiledPolicyHolder{}
+	h.Store(c)
+	return h
+}
+
+// Load retrieves the current compiled policy
+func (h *CompiledPolicyHolder) Load() *CompiledPolicy {
+	c, _ := h.v.Load().(*CompiledPolicy)
+	return c
+}
+
+// Store replaces the current compiled policy
+func (h *CompiledPolicyHolder) Store(c *CompiledPolicy) {
+	h.v.Store(c)
+}
@@ -0,0 +1,107 @@
+package consulacl
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Compile(t *testing.T) {
+	p, err := NewPolicyFromRules(`keyring = "read"
+operator = "deny"
+key "" {
+  policy = "read"
+}
+key "app/" {
+  policy = "write"
+}
+key "app/secret" {
+  policy = "deny"
+}
+key "list/" {
+  policy = "list"
+}
+service "web" {
+  policy = "write"
+}
+session "node0" {
+  policy = "read"
+}`)
+	require.NoError(t, err)
+
+	c := p.Compile()
+	require.NotNil(t, c)
+
+	resources := append([]Resource{ResourceNone, ResourceKeyring, ResourceOperator}, TargetResources...)
+	targets := []string{"", "app", "app/", "app/config", "app/secret/db", "list/a", "web", "web-frontend", "node0"}
+	accesses := []Access{AccessNone, AccessList, AccessRead, AccessWrite}
+
+	for _, resource := range resources {
+		for _, target := range targets {
+			for _, access := range accesses {
+				assert.EqualValues(t, p.Evaluate(resource, target, access), c.Evaluate(resource, target, access),
+					"%s %q %s", resource.String(), target, access.String())
+			}
+		}
+	}
+
+	// Ensure changes to the policy do not affect the compiled policy
+	p.Key().Set("app/", GrantDeny)
+	p.SetKeyring(GrantNone)
+	assert.True(t, c.Allows(ResourceKey, "app/config", AccessWrite))
+	assert.True(t, c.Allows(ResourceKeyring, "", AccessRead))
+}
+
+func TestCompiledPolicy_Nil(t *testing.T) {
+	var c *CompiledPolicy
+	d := c.Evaluate(ResourceKey, "test", AccessRead)
+	assert.False(t, d.Allowed)
+	assert.False(t, d.Matched)
+	assert.False(t, c.Allows(ResourceOperator, "", AccessRead))
+}
+
+func TestCompiledPolicyHolder(t *testing.T) {
+	t.Run("Zero", func(t *testing.T) {
+		h := &CompiledPolicyHolder{}
+		assert.Nil(t, h.Load())
+		assert.False(t, h.Load().Allows(ResourceKey, "test", AccessRead))
+	})
+
+	t.Run("Store", func(t *testing.T) {
+		p := NewPolicy()
+		p.Key().Set("test", GrantRead)
+		c := p.Compile()
+
+		h := NewCompiledPolicyHolder(c)
+		assert.True(t, h.Load() == c)
+
+		p.Key().Set("test", GrantDeny)
+		h.Store(p.Compile())
+		assert.False(t, h.Load().Allows(ResourceKey, "test", AccessRead))
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		p := NewPolicy()
+		h := NewCompiledPolicyHolder(p.Compile())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					h.Load().Allows(ResourceKey, "test", AccessRead)
+				}
+			}()
+		}
+		for i := 0; i < 100; i++ {
+			p.Key().Set(fmt.Sprintf("test%d", i), GrantRead)
+			h.Store(p.Compile())
+		}
+		wg.Wait()
+		assert.True(t, h.Load().Allows(ResourceKey, "test99", AccessRead))
+	})
+}
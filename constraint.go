@@ -0,0 +1,360 @@
+package consulacl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"gopkg.in/yaml.v2"
+)
+
+// ConstraintNameVariable is replaced by the policy name in the allowed targets of a constraint
+const ConstraintNameVariable = "${name}"
+
+// Constraint defines an organisation-wide guardrail for the rules of policies
+//
+// A constraint applies to the rules of a single resource whose targets match Targets, in policies whose
+// names match Tokens but not Except. All patterns are glob patterns, see GlobMatcher. Empty pattern lists
+// match everything, except for Except which matches nothing. Deny rules never violate constraints.
+type Constraint struct {
+	Name        string
+	Description string
+	Resource    Resource
+	// Targets restricts the constraint to rules with matching targets. It is ignored for global resources.
+	Targets []string
+	// Tokens restricts the constraint to policies with matching names
+	Tokens []string
+	// Except exempts policies with matching names from the constraint
+	Except []string
+	// MaxGrant defines the highest grant allowed, GrantNone allows every grant
+	MaxGrant Grant
+	// AllowedTargets restricts rules to matching targets, e.g. "${name}" allows the policy name only.
+	// ConstraintNameVariable is replaced by the policy name. It is ignored for global resources.
+	AllowedTargets []string
+}
+
+// Violation describes a rule violating a constraint
+type Violation struct {
+	Constraint string
+	// Policy is the name of the violating policy
+	Policy string
+	Rule   Rule
+	Reason string
+}
+
+// String returns the string representation of a violation
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s violates %s: %s", v.Policy, v.Rule.String(), v.Constraint, v.Reason)
+}
+
+// matchesAny checks if the value matches any of the glob patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if GlobMatcher(pattern).Match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesTo checks if the constraint applies to the policy by the given name
+func (c *Constraint) AppliesTo(name string) bool {
+	return (len(c.Tokens) == 0 || matchesAny(c.Tokens, name)) && !matchesAny(c.Except, name)
+}
+
+// Check returns all rules of the named policy which violate the constraint
+func (c *Constraint) Check(name string, p *Policy) []Violation {
+	if !c.AppliesTo(name) {
+		return nil
+	}
+
+	allowedTargets := make([]string, len(c.AllowedTargets))
+	for i, pattern := range c.AllowedTargets {
+		allowedTargets[i] = strings.Replace(pattern, ConstraintNameVariable, name, -1)
+	}
+
+	var violations []Violation
+	Walk(p, VisitorFunc(func(rule Rule) {
+		if rule.Resource != c.Resource || rule.Grant == GrantDeny {
+			return
+		}
+		global := rule.Resource.IsGlobal()
+		if !global && len(c.Targets) > 0 && !matchesAny(c.Targets, rule.Target) {
+			return
+		}
+
+		violation := Violation{Constraint: c.Name, Policy: name, Rule: rule}
+		switch {
+		case c.MaxGrant != GrantNone && rule.Grant > c.MaxGrant:
+			violation.Reason = fmt.Sprintf("grant exceeds %q", c.MaxGrant.String())
+		case !global && len(allowedTargets) > 0 && !matchesAny(allowedTargets, rule.Target):
+			violation.Reason = fmt.Sprintf("target not in %q", allowedTargets)
+		default:
+			return
+		}
+		violations = append(violations, violation)
+	}))
+	return violations
+}
+
+// ConstraintError is returned if a policy violates constraints
+type ConstraintError struct {
+	Violations []Violation
+}
+
+// Error implements error
+func (e *ConstraintError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return fmt.Sprintf("%d constraint violations: %s", len(e.Violations), strings.Join(messages, "; "))
+}
+
+// Constraints holds a list of constraints
+type Constraints []*Constraint
+
+// Check returns all violations of the named policy, ordered by constraint
+func (cs Constraints) Check(name string, p *Policy) []Violation {
+	var violations []Violation
+	for _, c := range cs {
+		violations = append(violations, c.Check(name, p)...)
+	}
+	return violations
+}
+
+// CheckSet returns the violations of all policies of the set by policy name
+//
+// Policies without violations are not included.
+func (cs Constraints) CheckSet(s *PolicySet) map[string][]Violation {
+	violations := make(map[string][]Violation)
+	for _, name := range s.Names() {
+		if policyViolations := cs.Check(name, s.Get(name)); len(policyViolations) > 0 {
+			violations[name] = policyViolations
+		}
+	}
+	return violations
+}
+
+// constraintFile defines the structure of constraint files
+type constraintFile struct {
+	Constraints []*constraintSpec `hcl:"constraint,expand"`
+}
+
+type constraintSpec struct {
+	Name           string   `hcl:",key" yaml:"-"`
+	Description    string   `hcl:"description" yaml:"description"`
+	Resource       string   `hcl:"resource" yaml:"resource"`
+	Targets        []string `hcl:"targets" yaml:"targets"`
+	Tokens         []string `hcl:"tokens" yaml:"tokens"`
+	Except         []string `hcl:"except" yaml:"except"`
+	MaxGrant       string   `hcl:"max_grant" yaml:"max_grant"`
+	AllowedTargets []string `hcl:"allowed_targets" yaml:"allowed_targets"`
+}
+
+// constraintKeys holds the keys allowed in a constraint, the decoders silently ignore unknown ones
+var constraintKeys = map[string]bool{
+	"description":     true,
+	"resource":        true,
+	"targets":         true,
+	"tokens":          true,
+	"except":          true,
+	"max_grant":       true,
+	"allowed_targets": true,
+}
+
+// constraint converts the spec to a constraint
+func (spec *constraintSpec) constraint() (*Constraint, error) {
+	c := &Constraint{
+		Name:           spec.Name,
+		Description:    spec.Description,
+		Resource:       ResourceByName(spec.Resource),
+		Targets:        spec.Targets,
+		Tokens:         spec.Tokens,
+		Except:         spec.Except,
+		AllowedTargets: spec.AllowedTargets,
+	}
+	if c.Resource == ResourceNone {
+		return nil, fmt.Errorf("constraint %q: invalid resource: %q", spec.Name, spec.Resource)
+	}
+	if spec.MaxGrant != "" {
+		if c.MaxGrant = GrantByName(spec.MaxGrant); c.MaxGrant == GrantNone {
+			return nil, fmt.Errorf("constraint %q: invalid grant: %q", spec.Name, spec.MaxGrant)
+		}
+	}
+	if c.MaxGrant == GrantNone && len(c.AllowedTargets) == 0 {
+		return nil, fmt.Errorf("constraint %q: neither max_grant nor allowed_targets is set", spec.Name)
+	}
+	return c, nil
+}
+
+// checkConstraintKeys returns an error for the first unknown key in the constraint blocks of f
+func checkConstraintKeys(f *ast.File) error {
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil
+	}
+
+	for _, item := range list.Items {
+		key, _ := item.Keys[0].Token.Value().(string)
+		if key != "constraint" {
+			return fmt.Errorf("unknown key %q", key)
+		}
+
+		if len(item.Keys) > 1 {
+			name, _ := item.Keys[1].Token.Value().(string)
+			if err := checkConstraintBlockKeys(name, item.Val); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The JSON parser keeps the names as nested keys, e.g. {"constraint": {"name": {...}}}
+		object, ok := item.Val.(*ast.ObjectType)
+		if !ok {
+			continue
+		}
+		for _, nested := range object.List.Items {
+			name, _ := nested.Keys[0].Token.Value().(string)
+			if err := checkConstraintBlockKeys(name, nested.Val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkConstraintBlockKeys(name string, node ast.Node) error {
+	object, ok := node.(*ast.ObjectType)
+	if !ok {
+		return nil
+	}
+	for _, item := range object.List.Items {
+		key, _ := item.Keys[0].Token.Value().(string)
+		if !constraintKeys[key] {
+			return fmt.Errorf("constraint %q: unknown key %q", name, key)
+		}
+	}
+	return nil
+}
+
+// ParseConstraints parses constraints in HCL or JSON format
+//
+// Unknown keys and constraints which neither set max_grant nor allowed_targets are rejected.
+//
+// Example:
+//
+//	constraint "operator-write" {
+//	  description = "Only ops tokens may write operator data"
+//	  resource = "operator"
+//	  max_grant = "read"
+//	  except = ["ops-*"]
+//	}
+func ParseConstraints(src string) (Constraints, error) {
+	f, err := hcl.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConstraintKeys(f); err != nil {
+		return nil, err
+	}
+
+	var file constraintFile
+	if err := hcl.DecodeObject(&file, f); err != nil {
+		return nil, err
+	}
+
+	constraints := make(Constraints, 0, len(file.Constraints))
+	for _, spec := range file.Constraints {
+		c, err := spec.constraint()
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, nil
+}
+
+// constraintYAMLFile defines the structure of constraint files in YAML format. The constraints are kept
+// as map slice to retain their order.
+type constraintYAMLFile struct {
+	Constraint yaml.MapSlice `yaml:"constraint"`
+}
+
+// ParseConstraintsYAML parses constraints in YAML format, see ParseConstraints
+//
+// Example:
+//
+//	constraint:
+//	  operator-write:
+//	    description: Only ops tokens may write operator data
+//	    resource: operator
+//	    max_grant: read
+//	    except: ["ops-*"]
+func ParseConstraintsYAML(src string) (Constraints, error) {
+	var file constraintYAMLFile
+	if err := yaml.UnmarshalStrict([]byte(src), &file); err != nil {
+		return nil, err
+	}
+
+	constraints := make(Constraints, 0, len(file.Constraint))
+	for _, item := range file.Constraint {
+		name, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid constraint name: %v", item.Key)
+		}
+
+		// Nested mappings are decoded as map slices as well
+		fields, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("constraint %q: not a mapping", name)
+		}
+		for _, field := range fields {
+			if key, _ := field.Key.(string); !constraintKeys[key] {
+				return nil, fmt.Errorf("constraint %q: unknown key %q", name, field.Key)
+			}
+		}
+
+		data, err := yaml.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		spec := &constraintSpec{Name: name}
+		if err := yaml.Unmarshal(data, spec); err != nil {
+			return nil, fmt.Errorf("constraint %q: %v", name, err)
+		}
+
+		c, err := spec.constraint()
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, nil
+}
+
+// LoadConstraintsFile reads constraints from a file
+//
+// Files with a .yaml or .yml extension are parsed as YAML, see ParseConstraintsYAML. All other files are
+// parsed as HCL or JSON, see ParseConstraints.
+func LoadConstraintsFile(file string) (Constraints, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := ParseConstraints
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		parse = ParseConstraintsYAML
+	}
+
+	constraints, err := parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return constraints, nil
+}
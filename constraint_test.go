@@ -0,0 +1,241 @@
+package consulacl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConstraints = `
+constraint "root-key" {
+  description = "No write access to the whole key/value store"
+  resource = "key"
+  targets = [""]
+  max_grant = "read"
+}
+
+constraint "operator-write" {
+  resource = "operator"
+  max_grant = "read"
+  except = ["ops-*"]
+}
+
+constraint "own-session" {
+  resource = "session"
+  allowed_targets = ["${name}"]
+}
+`
+
+func testConstraintPolicySet() *PolicySet {
+	s := NewPolicySet()
+
+	ops := NewPolicy()
+	ops.SetOperator(GrantWrite)
+	ops.Key().Set("", GrantWrite)
+	s.Set("ops-admin", ops)
+
+	web := NewPolicy()
+	web.SetOperator(GrantWrite)
+	web.Key().Set("", GrantDeny)
+	web.Key().Set("web/", GrantWrite)
+	web.Session().Set("web", GrantWrite)
+	web.Session().Set("db", GrantRead)
+	s.Set("web", web)
+
+	db := NewPolicy()
+	db.Key().Set("", GrantRead)
+	db.Session().Set("db", GrantWrite)
+	s.Set("db", db)
+
+	return s
+}
+
+func TestViolation_String(t *testing.T) {
+	v := Violation{Constraint: "root-key", Policy: "web", Rule: Rule{Resource: ResourceKey, Target: "", Grant: GrantWrite}, Reason: `grant exceeds "read"`}
+	assert.EqualValues(t, `web: key "" = "write" violates root-key: grant exceeds "read"`, v.String())
+}
+
+func TestConstraint_AppliesTo(t *testing.T) {
+	c := &Constraint{}
+	assert.True(t, c.AppliesTo("web"))
+
+	c.Tokens = []string{"app-*", "web"}
+	c.Except = []string{"app-admin"}
+	assert.True(t, c.AppliesTo("web"))
+	assert.True(t, c.AppliesTo("app-db"))
+	assert.False(t, c.AppliesTo("app-admin"))
+	assert.False(t, c.AppliesTo("db"))
+}
+
+func TestConstraint_Check(t *testing.T) {
+	p := NewPolicy()
+	p.Key().Set("", GrantWrite)
+	p.Key().Set("app/", GrantWrite)
+	p.Key().Set("other/", GrantDeny)
+	p.SetOperator(GrantWrite)
+
+	t.Run("MaxGrant", func(t *testing.T) {
+		c := &Constraint{Name: "keys", Resource: ResourceKey, MaxGrant: GrantRead, Targets: []string{"", "app/*"}}
+		violations := c.Check("web", p)
+		require.Len(t, violations, 2)
+		assert.EqualValues(t, Violation{Constraint: "keys", Policy: "web", Rule: Rule{Resource: ResourceKey, Target: "", Grant: GrantWrite}, Reason: `grant exceeds "read"`}, violations[0])
+		assert.EqualValues(t, "app/", violations[1].Rule.Target)
+	})
+
+	t.Run("AllowedTargets", func(t *testing.T) {
+		c := &Constraint{Name: "keys", Resource: ResourceKey, AllowedTargets: []string{"${name}/*"}}
+		violations := c.Check("app", p)
+		require.Len(t, violations, 1)
+		assert.EqualValues(t, "", violations[0].Rule.Target)
+		assert.EqualValues(t, `target not in ["app/*"]`, violations[0].Reason)
+	})
+
+	t.Run("Global", func(t *testing.T) {
+		c := &Constraint{Name: "operator", Resource: ResourceOperator, MaxGrant: GrantRead, Targets: []string{"ignored"}, AllowedTargets: []string{"ignored"}}
+		violations := c.Check("web", p)
+		require.Len(t, violations, 1)
+		assert.EqualValues(t, Rule{Resource: ResourceOperator, Grant: GrantWrite}, violations[0].Rule)
+
+		c.Except = []string{"web"}
+		assert.Empty(t, c.Check("web", p))
+	})
+}
+
+func TestConstraints_CheckSet(t *testing.T) {
+	cs, err := ParseConstraints(testConstraints)
+	require.NoError(t, err)
+
+	violations := cs.CheckSet(testConstraintPolicySet())
+	assert.NotContains(t, violations, "db")
+	assert.EqualValues(t, []Violation{
+		{Constraint: "root-key", Policy: "ops-admin", Rule: Rule{Resource: ResourceKey, Target: "", Grant: GrantWrite}, Reason: `grant exceeds "read"`},
+	}, violations["ops-admin"])
+	assert.EqualValues(t, []Violation{
+		{Constraint: "operator-write", Policy: "web", Rule: Rule{Resource: ResourceOperator, Grant: GrantWrite}, Reason: `grant exceeds "read"`},
+		{Constraint: "own-session", Policy: "web", Rule: Rule{Resource: ResourceSession, Target: "db", Grant: GrantRead}, Reason: `target not in ["web"]`},
+	}, violations["web"])
+}
+
+func TestConstraintError_Error(t *testing.T) {
+	err := &ConstraintError{Violations: []Violation{
+		{Constraint: "a", Policy: "web", Rule: Rule{Resource: ResourceOperator, Grant: GrantWrite}, Reason: "reason"},
+		{Constraint: "b", Policy: "web", Rule: Rule{Resource: ResourceKeyring, Grant: GrantWrite}, Reason: "reason"},
+	}}
+	assert.EqualValues(t, `2 constraint violations: web: operator = "write" violates a: reason; web: keyring = "write" violates b: reason`, err.Error())
+}
+
+func TestParseConstraints(t *testing.T) {
+	cs, err := ParseConstraints(testConstraints)
+	require.NoError(t, err)
+	require.Len(t, cs, 3)
+	assert.EqualValues(t, &Constraint{
+		Name:        "root-key",
+		Description: "No write access to the whole key/value store",
+		Resource:    ResourceKey,
+		Targets:     []string{""},
+		MaxGrant:    GrantRead,
+	}, cs[0])
+	assert.EqualValues(t, []string{"ops-*"}, cs[1].Except)
+	assert.EqualValues(t, []string{"${name}"}, cs[2].AllowedTargets)
+
+	t.Run("JSON", func(t *testing.T) {
+		cs, err := ParseConstraints(`{"constraint": {"operator-write": {"resource": "operator", "max_grant": "read", "except": ["ops-*"]}}}`)
+		require.NoError(t, err)
+		require.Len(t, cs, 1)
+		assert.EqualValues(t, "operator-write", cs[0].Name)
+		assert.EqualValues(t, GrantRead, cs[0].MaxGrant)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ParseConstraints(`constraint "a" { resource = "unknown" }`)
+		assert.EqualError(t, err, `constraint "a": invalid resource: "unknown"`)
+		_, err = ParseConstraints(`constraint "a" { resource = "key" max_grant = "all" }`)
+		assert.EqualError(t, err, `constraint "a": invalid grant: "all"`)
+		_, err = ParseConstraints(`constraint "a" {`)
+		assert.Error(t, err)
+	})
+
+	t.Run("UnknownKey", func(t *testing.T) {
+		_, err := ParseConstraints(`constraint "a" {
+  resource = "key"
+  max-grant = "read"
+}`)
+		assert.EqualError(t, err, `constraint "a": unknown key "max-grant"`)
+		_, err = ParseConstraints(`{"constraint": {"a": {"resource": "key", "maxGrant": "read"}}}`)
+		assert.EqualError(t, err, `constraint "a": unknown key "maxGrant"`)
+		_, err = ParseConstraints(`constraints "a" { resource = "key" }`)
+		assert.EqualError(t, err, `unknown key "constraints"`)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := ParseConstraints(`constraint "a" { resource = "key" }`)
+		assert.EqualError(t, err, `constraint "a": neither max_grant nor allowed_targets is set`)
+	})
+}
+
+const testYAMLConstraints = `
+constraint:
+  root-key:
+    description: No write access to the whole key/value store
+    resource: key
+    targets: [""]
+    max_grant: read
+  operator-write:
+    resource: operator
+    max_grant: read
+    except: ["ops-*"]
+  own-session:
+    resource: session
+    allowed_targets: ["${name}"]
+`
+
+func TestParseConstraintsYAML(t *testing.T) {
+	cs, err := ParseConstraintsYAML(testYAMLConstraints)
+	require.NoError(t, err)
+	expected, err := ParseConstraints(testConstraints)
+	require.NoError(t, err)
+	assert.EqualValues(t, expected, cs)
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ParseConstraintsYAML("constraint:\n  a:\n    resource: key\n    max-grant: read\n")
+		assert.EqualError(t, err, `constraint "a": unknown key "max-grant"`)
+		_, err = ParseConstraintsYAML("constraint:\n  a:\n    resource: key\n")
+		assert.EqualError(t, err, `constraint "a": neither max_grant nor allowed_targets is set`)
+		_, err = ParseConstraintsYAML("constraint:\n  a:\n    resource: unknown\n    max_grant: read\n")
+		assert.EqualError(t, err, `constraint "a": invalid resource: "unknown"`)
+		_, err = ParseConstraintsYAML("constraint:\n  a: key\n")
+		assert.EqualError(t, err, `constraint "a": not a mapping`)
+		_, err = ParseConstraintsYAML("constraints:\n  a:\n    resource: key\n")
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadConstraintsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-constraints")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "constraints.hcl")
+	require.NoError(t, ioutil.WriteFile(file, []byte(testConstraints), 0644))
+	cs, err := LoadConstraintsFile(file)
+	require.NoError(t, err)
+	assert.Len(t, cs, 3)
+
+	invalid := filepath.Join(dir, "invalid.hcl")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte(`constraint "a" { resource = "unknown" }`), 0644))
+	_, err = LoadConstraintsFile(invalid)
+	assert.EqualError(t, err, invalid+`: constraint "a": invalid resource: "unknown"`)
+
+	yamlFile := filepath.Join(dir, "constraints.yml")
+	require.NoError(t, ioutil.WriteFile(yamlFile, []byte(testYAMLConstraints), 0644))
+	cs, err = LoadConstraintsFile(yamlFile)
+	require.NoError(t, err)
+	assert.Len(t, cs, 3)
+
+	_, err = LoadConstraintsFile(filepath.Join(dir, "missing.hcl"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package consulacl_test
+
+import (
+	"github.com/anexia-it/consulacl"
+	"github.com/anexia-it/consulacl/consulacltest"
+	"github.com/hashicorp/consul/api"
+)
+
+// testPolicySet returns the desired policies shared by the tests against consulacltest.Server
+//
+// The set holds write access to the "app/" keys, the "web" service and the "db" service.
+func testPolicySet() *consulacl.PolicySet {
+	s := consulacl.NewPolicySet()
+	app := consulacl.NewPolicy()
+	app.Key().Set("app/", consulacl.GrantWrite)
+	s.Set("app", app)
+	web := consulacl.NewPolicy()
+	web.Service().Set("web", consulacl.GrantWrite)
+	s.Set("web", web)
+	db := consulacl.NewPolicy()
+	db.Service().Set("db", consulacl.GrantWrite)
+	s.Set("db", db)
+	return s
+}
+
+// newTestServer starts a fake server holding the given tokens. The server has to be closed by the caller.
+func newTestServer(tokens ...*api.ACLEntry) *consulacltest.Server {
+	server := consulacltest.NewServer()
+	for _, token := range tokens {
+		server.SetToken(token)
+	}
+	return server
+}
@@ -0,0 +1,26 @@
+package consulacltest
+
+import (
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+)
+
+// RunCases runs the test cases of the JSON or YAML file against the policy, every case as subtest of t
+//
+// See consulacl.TestCase for the format of the file.
+func RunCases(t *testing.T, p *consulacl.Policy, file string) {
+	cases, err := consulacl.LoadTestCasesFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.String(), func(t *testing.T) {
+			if result := c.Run(p); !result.Passed {
+				t.Error(result.Explanation())
+			}
+		})
+	}
+}
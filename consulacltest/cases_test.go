@@ -0,0 +1,24 @@
+package consulacltest
+
+import (
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCases(t *testing.T) {
+	p, err := consulacl.NewPolicyFromRules(`
+key "app/" { policy = "write" }
+key "app/db" { policy = "read" }
+operator = "read"
+`)
+	require.NoError(t, err)
+
+	t.Run("JSON", func(t *testing.T) {
+		RunCases(t, p, "testdata/cases.json")
+	})
+	t.Run("YAML", func(t *testing.T) {
+		RunCases(t, p, "testdata/cases.yaml")
+	})
+}
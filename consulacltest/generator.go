@@ -0,0 +1,106 @@
+package consulacltest
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/anexia-it/consulacl"
+)
+
+const (
+	// DefaultAlphabet defines the default characters of generated target segments. It includes characters
+	// which need escaping in rules.
+	DefaultAlphabet = "abcxyz019-_.\"\\${}\n"
+	// DefaultSeparator defines the default separator of generated target segments
+	DefaultSeparator = "/"
+)
+
+// Generator generates random but valid policies, e.g. for property-based tests
+//
+// Targets are made of up to MaxDepth segments separated by Separator, so generated policies contain
+// overlapping prefixes.
+type Generator struct {
+	// Alphabet defines the characters of target segments
+	Alphabet string
+	// Separator is placed between target segments
+	Separator string
+	// MaxDepth defines the maximum number of segments of a target. Targets of zero segments are empty.
+	MaxDepth int
+	// MaxSegmentLength defines the maximum length of a target segment
+	MaxSegmentLength int
+	// MaxTargets defines the maximum number of targets per resource
+	MaxTargets int
+	// Grants defines the grants to choose from. GrantList is only used for keys, as consul rejects it
+	// for all other resources.
+	Grants []consulacl.Grant
+
+	rand *rand.Rand
+}
+
+// NewGenerator constructs a new generator using the given seed and default settings
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		Alphabet:         DefaultAlphabet,
+		Separator:        DefaultSeparator,
+		MaxDepth:         3,
+		MaxSegmentLength: 3,
+		MaxTargets:       5,
+		Grants:           []consulacl.Grant{consulacl.GrantDeny, consulacl.GrantList, consulacl.GrantRead, consulacl.GrantWrite},
+		rand:             rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Target generates a random target
+func (g *Generator) Target() string {
+	depth := g.rand.Intn(g.MaxDepth + 1)
+	segments := make([]string, depth)
+	for i := range segments {
+		segment := make([]byte, 1+g.rand.Intn(g.MaxSegmentLength))
+		for j := range segment {
+			segment[j] = g.Alphabet[g.rand.Intn(len(g.Alphabet))]
+		}
+		segments[i] = string(segment)
+	}
+
+	target := strings.Join(segments, g.Separator)
+	// Let some targets end with the separator, as usual for key prefixes
+	if depth > 0 && g.rand.Intn(2) == 0 {
+		target += g.Separator
+	}
+	return target
+}
+
+// Grant chooses a random grant which is valid for the given resource
+//
+// GrantNone is returned if no grant of Grants is valid for the resource.
+func (g *Generator) Grant(resource consulacl.Resource) consulacl.Grant {
+	grants := make([]consulacl.Grant, 0, len(g.Grants))
+	for _, grant := range g.Grants {
+		if grant == consulacl.GrantNone || (grant == consulacl.GrantList && resource != consulacl.ResourceKey) {
+			continue
+		}
+		grants = append(grants, grant)
+	}
+	if len(grants) == 0 {
+		return consulacl.GrantNone
+	}
+	return grants[g.rand.Intn(len(grants))]
+}
+
+// Policy generates a random policy
+func (g *Generator) Policy() *consulacl.Policy {
+	p := consulacl.NewPolicy()
+
+	for _, resource := range []consulacl.Resource{consulacl.ResourceKeyring, consulacl.ResourceOperator} {
+		if g.rand.Intn(2) == 0 {
+			p.SetGrant(resource, "", g.Grant(resource))
+		}
+	}
+
+	for _, resource := range consulacl.TargetResources {
+		for n := g.rand.Intn(g.MaxTargets + 1); n > 0; n-- {
+			p.SetGrant(resource, g.Target(), g.Grant(resource))
+		}
+	}
+	return p
+}
@@ -0,0 +1,49 @@
+package consulacltest
+
+import (
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGenerator(t *testing.T) {
+	// Equal seeds generate equal policies
+	assert.True(t, NewGenerator(1).Policy().Equals(NewGenerator(1).Policy()))
+}
+
+func TestGenerator_Target(t *testing.T) {
+	g := NewGenerator(1)
+	g.Alphabet = "a"
+	g.MaxDepth = 2
+	g.MaxSegmentLength = 1
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		seen[g.Target()] = true
+	}
+	assert.EqualValues(t, map[string]bool{"": true, "a": true, "a/": true, "a/a": true, "a/a/": true}, seen)
+}
+
+func TestGenerator_Grant(t *testing.T) {
+	g := NewGenerator(1)
+	for i := 0; i < 100; i++ {
+		assert.NotEqual(t, consulacl.GrantList, g.Grant(consulacl.ResourceService))
+		assert.NotEqual(t, consulacl.GrantNone, g.Grant(consulacl.ResourceKey))
+	}
+
+	g.Grants = []consulacl.Grant{consulacl.GrantList}
+	assert.EqualValues(t, consulacl.GrantList, g.Grant(consulacl.ResourceKey))
+	assert.EqualValues(t, consulacl.GrantNone, g.Grant(consulacl.ResourceOperator))
+}
+
+func TestGenerator_Policy(t *testing.T) {
+	g := NewGenerator(1)
+	for i := 0; i < 100; i++ {
+		p := g.Policy()
+		rules := p.GenerateRules()
+		_, err := consulacl.NewPolicyFromRules(rules)
+		require.NoError(t, err, rules)
+	}
+}
@@ -0,0 +1,301 @@
+package consulacltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// DefaultMaxValueSize defines the default maximum size of KV values, matching the default of consul
+const DefaultMaxValueSize = 512 * 1024
+
+// KV returns a copy of the pair stored at the key, nil if it does not exist
+func (s *Server) KV(key string) *api.KVPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pair, exists := s.pairs[key]
+	if !exists {
+		return nil
+	}
+	copied := *pair
+	return &copied
+}
+
+// SetKV stores the value at the key without checking its size and returns the modify index
+func (s *Server) SetKV(key string, value []byte) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index++
+	s.setPair(key, value)
+	s.modified()
+	return s.index
+}
+
+// setPair stores the value at the key using the current index. The caller has to hold the lock.
+func (s *Server) setPair(key string, value []byte) *api.KVPair {
+	pair := &api.KVPair{Key: key, Value: value, CreateIndex: s.index, ModifyIndex: s.index}
+	if existing, exists := s.pairs[key]; exists {
+		pair.CreateIndex = existing.CreateIndex
+	}
+	s.pairs[key] = pair
+	return pair
+}
+
+// deletePrefix removes all pairs whose key starts with the prefix. The caller has to hold the lock.
+func (s *Server) deletePrefix(prefix string) {
+	for key := range s.pairs {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.pairs, key)
+		}
+	}
+}
+
+// pairsWithPrefix returns copies of all pairs whose key starts with the prefix sorted by key. The caller has
+// to hold the lock.
+func (s *Server) pairsWithPrefix(prefix string) api.KVPairs {
+	var pairs api.KVPairs
+	for key, pair := range s.pairs {
+		if strings.HasPrefix(key, prefix) {
+			copied := *pair
+			pairs = append(pairs, &copied)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+	return pairs
+}
+
+// serveKV serves the KV and transaction endpoints
+func (s *Server) serveKV(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/txn" {
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.txn(w, r)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		s.query(w, r, func() interface{} {
+			return s.getKV(key, q)
+		})
+	case http.MethodPut:
+		s.putKV(w, r, key)
+	case http.MethodDelete:
+		s.deleteKV(w, r, key)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getKV returns the result of a KV read, nil if nothing was found. The caller has to hold the lock.
+func (s *Server) getKV(key string, q map[string][]string) interface{} {
+	pairs := s.pairsWithPrefix(key)
+	if _, isKeys := q["keys"]; isKeys {
+		separator := ""
+		if values := q["separator"]; len(values) > 0 {
+			separator = values[0]
+		}
+		var keys []string
+		for _, pair := range pairs {
+			k := pair.Key
+			// Collapse keys below the separator into their folder
+			if i := strings.Index(k[len(key):], separator); separator != "" && i >= 0 {
+				k = k[:len(key)+i+len(separator)]
+			}
+			if len(keys) == 0 || keys[len(keys)-1] != k {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		return keys
+	}
+	if _, isRecurse := q["recurse"]; isRecurse {
+		if len(pairs) == 0 {
+			return nil
+		}
+		return pairs
+	}
+
+	pair, exists := s.pairs[key]
+	if !exists {
+		return nil
+	}
+	copied := *pair
+	return api.KVPairs{&copied}
+}
+
+func (s *Server) putKV(w http.ResponseWriter, r *http.Request, key string) {
+	value, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(value) > s.MaxValueSize {
+		http.Error(w, fmt.Sprintf("Request body(%d bytes) too large, max size: %d bytes", len(value), s.MaxValueSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cas := r.URL.Query().Get("cas"); cas != "" {
+		index, err := strconv.ParseUint(cas, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid CAS index", http.StatusBadRequest)
+			return
+		}
+		if s.modifyIndex(key) != index {
+			writeJSON(w, false)
+			return
+		}
+	}
+
+	s.index++
+	s.setPair(key, value)
+	s.modified()
+	writeJSON(w, true)
+}
+
+func (s *Server) deleteKV(w http.ResponseWriter, r *http.Request, key string) {
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cas := q.Get("cas"); cas != "" {
+		index, err := strconv.ParseUint(cas, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid CAS index", http.StatusBadRequest)
+			return
+		}
+		if current := s.modifyIndex(key); current != 0 && current != index {
+			writeJSON(w, false)
+			return
+		}
+	}
+
+	s.index++
+	if _, isRecurse := q["recurse"]; isRecurse {
+		s.deletePrefix(key)
+	} else {
+		delete(s.pairs, key)
+	}
+	s.modified()
+	writeJSON(w, true)
+}
+
+// modifyIndex returns the modify index of the key, zero if it does not exist. The caller has to hold the lock.
+func (s *Server) modifyIndex(key string) uint64 {
+	if pair, exists := s.pairs[key]; exists {
+		return pair.ModifyIndex
+	}
+	return 0
+}
+
+// txn serves the transaction endpoint
+//
+// All operations are checked before any of them is applied. Failed checks are reported using the error
+// messages of consul and the conflict status code.
+func (s *Server) txn(w http.ResponseWriter, r *http.Request) {
+	var ops api.TxnOps
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp api.TxnResponse
+	fail := func(i int, format string, args ...interface{}) {
+		resp.Errors = append(resp.Errors, &api.TxnError{OpIndex: i, What: fmt.Sprintf(format, args...)})
+	}
+	for i, op := range ops {
+		if op.KV == nil {
+			fail(i, "unsupported operation")
+			continue
+		}
+		kv := op.KV
+		if len(kv.Value) > s.MaxValueSize {
+			fail(i, "Value for key %q is too large (%d > %d bytes)", kv.Key, len(kv.Value), s.MaxValueSize)
+			continue
+		}
+
+		current := s.modifyIndex(kv.Key)
+		switch kv.Verb {
+		case api.KVSet, api.KVGet, api.KVGetTree, api.KVDelete, api.KVDeleteTree:
+		case api.KVCAS:
+			if current != kv.Index {
+				fail(i, "failed to set key %q, index is stale", kv.Key)
+			}
+		case api.KVDeleteCAS:
+			if current != 0 && current != kv.Index {
+				fail(i, "failed to delete key %q, index is stale", kv.Key)
+			}
+		case api.KVCheckIndex:
+			if current == 0 {
+				fail(i, "key %q doesn't exist", kv.Key)
+			} else if current != kv.Index {
+				fail(i, "current modify index %d != %d", current, kv.Index)
+			}
+		case api.KVCheckNotExists:
+			if current != 0 {
+				fail(i, "key %q exists", kv.Key)
+			}
+		default:
+			fail(i, "unknown KV verb %q", kv.Verb)
+		}
+	}
+	if len(resp.Errors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	// Only transactions with write operations advance the index
+	for _, op := range ops {
+		if verb := op.KV.Verb; verb != api.KVGet && verb != api.KVGetTree && verb != api.KVCheckIndex && verb != api.KVCheckNotExists {
+			s.index++
+			s.modified()
+			break
+		}
+	}
+	for _, op := range ops {
+		kv := op.KV
+		switch kv.Verb {
+		case api.KVSet, api.KVCAS:
+			pair := *s.setPair(kv.Key, kv.Value)
+			// Values are only returned for reads
+			pair.Value = nil
+			resp.Results = append(resp.Results, &api.TxnResult{KV: &pair})
+		case api.KVGet, api.KVCheckIndex:
+			if pair, exists := s.pairs[kv.Key]; exists {
+				copied := *pair
+				resp.Results = append(resp.Results, &api.TxnResult{KV: &copied})
+			}
+		case api.KVGetTree:
+			for _, pair := range s.pairsWithPrefix(kv.Key) {
+				resp.Results = append(resp.Results, &api.TxnResult{KV: pair})
+			}
+		case api.KVDelete, api.KVDeleteCAS:
+			delete(s.pairs, kv.Key)
+		case api.KVDeleteTree:
+			s.deletePrefix(kv.Key)
+		}
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,183 @@
+package consulacltest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_KV(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	kv := s.Client().KV()
+
+	_, err := kv.Put(&api.KVPair{Key: "app/config", Value: []byte("a")}, nil)
+	require.NoError(t, err)
+	index := s.SetKV("app/sub/key", []byte("b"))
+	s.SetKV("other", []byte("c"))
+
+	pair, meta, err := kv.Get("app/config", nil)
+	require.NoError(t, err)
+	require.NotNil(t, pair)
+	assert.EqualValues(t, "a", pair.Value)
+	assert.EqualValues(t, s.Index(), meta.LastIndex)
+	assert.EqualValues(t, index, s.KV("app/sub/key").ModifyIndex)
+	assert.Nil(t, s.KV("missing"))
+
+	pair, _, err = kv.Get("missing", nil)
+	require.NoError(t, err)
+	assert.Nil(t, pair)
+
+	keys, _, err := kv.Keys("app/", "", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"app/config", "app/sub/key"}, keys)
+	keys, _, err = kv.Keys("app/", "/", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"app/config", "app/sub/"}, keys)
+
+	pairs, _, err := kv.List("app/", nil)
+	require.NoError(t, err)
+	assert.Len(t, pairs, 2)
+
+	t.Run("CAS", func(t *testing.T) {
+		ok, _, err := kv.CAS(&api.KVPair{Key: "app/config", Value: []byte("x"), ModifyIndex: 1}, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		current := s.KV("app/config")
+		ok, _, err = kv.CAS(&api.KVPair{Key: "app/config", Value: []byte("x"), ModifyIndex: current.ModifyIndex}, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.EqualValues(t, "x", s.KV("app/config").Value)
+		assert.EqualValues(t, current.CreateIndex, s.KV("app/config").CreateIndex)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ok, _, err := kv.DeleteCAS(&api.KVPair{Key: "other", ModifyIndex: 1}, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, err = kv.Delete("other", nil)
+		require.NoError(t, err)
+		assert.Nil(t, s.KV("other"))
+
+		_, err = kv.DeleteTree("app/", nil)
+		require.NoError(t, err)
+		keys, _, err := kv.Keys("", "", nil)
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		s.MaxValueSize = 4
+		defer func() {
+			s.MaxValueSize = DefaultMaxValueSize
+		}()
+		_, err := kv.Put(&api.KVPair{Key: "large", Value: []byte("large")}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestServer_KVBlockingQuery(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	kv := s.Client().KV()
+
+	index := s.SetKV("test", []byte("a"))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.SetKV("test", []byte("b"))
+	}()
+
+	pair, meta, err := kv.Get("test", &api.QueryOptions{WaitIndex: index, WaitTime: 5 * time.Second})
+	require.NoError(t, err)
+	assert.EqualValues(t, "b", pair.Value)
+	assert.True(t, meta.LastIndex > index)
+}
+
+func TestServer_Txn(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	kv := s.Client().KV()
+
+	index := s.SetKV("a", []byte("a"))
+
+	t.Run("OK", func(t *testing.T) {
+		ok, resp, _, err := kv.Txn(api.KVTxnOps{
+			{Verb: api.KVCheckIndex, Key: "a", Index: index},
+			{Verb: api.KVCAS, Key: "b", Value: []byte("b")},
+			{Verb: api.KVSet, Key: "c", Value: []byte("c")},
+			{Verb: api.KVDelete, Key: "a"},
+		}, nil)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Len(t, resp.Results, 3)
+		assert.EqualValues(t, "a", resp.Results[0].Value)
+		assert.Nil(t, resp.Results[1].Value)
+		assert.EqualValues(t, s.Index(), resp.Results[1].ModifyIndex)
+		assert.Nil(t, s.KV("a"))
+		assert.EqualValues(t, "b", s.KV("b").Value)
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		index := s.Index()
+		ok, resp, _, err := kv.Txn(api.KVTxnOps{
+			{Verb: api.KVGet, Key: "b"},
+			{Verb: api.KVCheckNotExists, Key: "a"},
+		}, nil)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Len(t, resp.Results, 1)
+		assert.EqualValues(t, index, s.Index())
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		index := s.Index()
+		ok, resp, _, err := kv.Txn(api.KVTxnOps{
+			{Verb: api.KVSet, Key: "d", Value: []byte("d")},
+			{Verb: api.KVCAS, Key: "b", Value: []byte("x"), Index: 1},
+			{Verb: api.KVCheckIndex, Key: "a", Index: 1},
+			{Verb: api.KVCheckNotExists, Key: "c"},
+			{Verb: api.KVDeleteCAS, Key: "c", Index: 1},
+		}, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		require.Len(t, resp.Errors, 4)
+		assert.EqualValues(t, 1, resp.Errors[0].OpIndex)
+		assert.EqualValues(t, `failed to set key "b", index is stale`, resp.Errors[0].What)
+		assert.EqualValues(t, `key "a" doesn't exist`, resp.Errors[1].What)
+		assert.EqualValues(t, `key "c" exists`, resp.Errors[2].What)
+		assert.EqualValues(t, `failed to delete key "c", index is stale`, resp.Errors[3].What)
+
+		// Nothing has been applied
+		assert.Nil(t, s.KV("d"))
+		assert.EqualValues(t, index, s.Index())
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		s.MaxValueSize = 4
+		defer func() {
+			s.MaxValueSize = DefaultMaxValueSize
+		}()
+		ok, resp, _, err := kv.Txn(api.KVTxnOps{
+			{Verb: api.KVSet, Key: "large", Value: []byte("large")},
+		}, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		require.Len(t, resp.Errors, 1)
+		assert.True(t, strings.HasPrefix(resp.Errors[0].What, `Value for key "large" is too large`))
+	})
+
+	t.Run("UnknownVerb", func(t *testing.T) {
+		ok, resp, _, err := kv.Txn(api.KVTxnOps{
+			{Verb: api.KVLock, Key: "lock"},
+		}, nil)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		require.Len(t, resp.Errors, 1)
+	})
+}
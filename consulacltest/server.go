@@ -0,0 +1,459 @@
+// Package consulacltest provides an in-process fake of the consul ACL and KV HTTP API for tests
+package consulacltest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// DefaultMaxWait defines the default maximum duration of blocking queries
+	DefaultMaxWait = 10 * time.Second
+	// DefaultDatacenter defines the default name of the primary datacenter
+	DefaultDatacenter = "dc1"
+)
+
+// Server is a fake consul server implementing the legacy ACL, KV and transaction endpoints
+//
+// The bootstrap, create, update, destroy, clone, info, list and replication ACL endpoints are implemented.
+// Every write increments the index of the server, read endpoints support blocking queries. Rules are
+// validated using consulacl.NewPolicyFromRules. Request tokens are not checked.
+//
+// Requests for secondary datacenters added using AddDatacenter are served by the primary datacenter, as
+// consul forwards ACL requests to the authoritative datacenter, except for the replication endpoint.
+// Requests for unknown datacenters fail.
+type Server struct {
+	// URL is the base URL of the server
+	URL string
+	// MaxWait limits the duration of blocking queries
+	MaxWait time.Duration
+	// Datacenter is the name of the primary datacenter
+	Datacenter string
+	// MaxValueSize limits the size of KV values
+	MaxValueSize int
+
+	server *httptest.Server
+
+	mu           sync.Mutex
+	index        uint64
+	tokens       map[string]*api.ACLEntry
+	pairs        map[string]*api.KVPair
+	bootstrapped bool
+	replication  api.ACLReplicationStatus
+	datacenters  map[string]*datacenter
+	fail         int
+	closed       bool
+	// changed is closed and replaced on every write to wake up blocking queries
+	changed chan struct{}
+}
+
+// datacenter simulates a secondary datacenter replicating the ACLs of the primary datacenter
+type datacenter struct {
+	step       uint64
+	replicated uint64
+}
+
+// NewServer starts a new fake server. The server has to be closed by the caller.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer constructs a new fake server without starting it
+func NewUnstartedServer() *Server {
+	s := &Server{
+		MaxWait:      DefaultMaxWait,
+		Datacenter:   DefaultDatacenter,
+		MaxValueSize: DefaultMaxValueSize,
+		index:        1,
+		tokens:       make(map[string]*api.ACLEntry),
+		pairs:        make(map[string]*api.KVPair),
+		datacenters:  make(map[string]*datacenter),
+		changed:      make(chan struct{}),
+	}
+	s.server = httptest.NewUnstartedServer(s)
+	return s
+}
+
+// Start starts the server
+func (s *Server) Start() {
+	s.server.Start()
+	s.URL = s.server.URL
+}
+
+// Close shuts down the server and blocks until all outstanding requests have completed
+func (s *Server) Close() {
+	s.mu.Lock()
+	// Wake up blocking queries, so closing does not wait for them to time out
+	s.closed = true
+	s.modified()
+	s.mu.Unlock()
+	s.server.Close()
+}
+
+// Client returns a consul API client connected to the server
+func (s *Server) Client() *api.Client {
+	client, err := api.NewClient(&api.Config{Address: s.URL})
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// Index returns the current index of the server
+func (s *Server) Index() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index
+}
+
+// Token returns a copy of the token with the given ID, nil if it does not exist
+func (s *Server) Token(id string) *api.ACLEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return nil
+	}
+	copied := *token
+	return &copied
+}
+
+// Tokens returns copies of all tokens sorted by ID
+func (s *Server) Tokens() []*api.ACLEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// SetToken creates or replaces a token without validating it and returns its ID
+//
+// An ID is generated if the entry has none. The indexes of the entry are set by the server.
+func (s *Server) SetToken(entry *api.ACLEntry) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(*entry)
+}
+
+// DeleteToken removes the token with the given ID
+func (s *Server) DeleteToken(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.tokens[id]; exists {
+		delete(s.tokens, id)
+		s.index++
+		s.modified()
+	}
+}
+
+// SetReplication configures the status reported by the replication endpoint of the primary datacenter
+func (s *Server) SetReplication(status api.ACLReplicationStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replication = status
+	s.modified()
+}
+
+// AddDatacenter adds a secondary datacenter replicating the ACLs of the primary datacenter
+//
+// Every request to the replication endpoint of the datacenter advances its replicated index by step, up to
+// the index of the server. A step of zero reports replication as disabled.
+func (s *Server) AddDatacenter(name string, step uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.datacenters[name] = &datacenter{step: step}
+}
+
+// FailNext makes the next n requests fail with an internal server error
+func (s *Server) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = n
+}
+
+func (s *Server) modified() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// set stores the entry and returns its ID. The caller has to hold the lock.
+func (s *Server) set(entry api.ACLEntry) string {
+	if entry.ID == "" {
+		entry.ID = generateID()
+	}
+	if entry.Type == "" {
+		entry.Type = api.ACLClientType
+	}
+
+	s.index++
+	entry.CreateIndex, entry.ModifyIndex = s.index, s.index
+	if existing, exists := s.tokens[entry.ID]; exists {
+		entry.CreateIndex = existing.CreateIndex
+	}
+	s.tokens[entry.ID] = &entry
+	s.modified()
+	return entry.ID
+}
+
+// list returns copies of all tokens sorted by ID. The caller has to hold the lock.
+func (s *Server) list() []*api.ACLEntry {
+	tokens := make([]*api.ACLEntry, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		copied := *token
+		tokens = append(tokens, &copied)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens
+}
+
+// generateID generates a random UUID
+func generateID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+}
+
+// endpointMethods holds the HTTP method of every implemented endpoint
+var endpointMethods = map[string]string{
+	"bootstrap":   http.MethodPut,
+	"create":      http.MethodPut,
+	"update":      http.MethodPut,
+	"destroy":     http.MethodPut,
+	"clone":       http.MethodPut,
+	"info":        http.MethodGet,
+	"list":        http.MethodGet,
+	"replication": http.MethodGet,
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.fail > 0 {
+		s.fail--
+		s.mu.Unlock()
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	var secondary *datacenter
+	if dc := r.URL.Query().Get("dc"); dc != "" && dc != s.Datacenter {
+		var exists bool
+		if secondary, exists = s.datacenters[dc]; !exists {
+			s.mu.Unlock()
+			http.Error(w, fmt.Sprintf("No path to datacenter %q", dc), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/"):
+		s.serveACL(w, r, secondary)
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") || r.URL.Path == "/v1/txn":
+		if secondary != nil {
+			http.Error(w, "KV requests are only supported for the primary datacenter", http.StatusBadRequest)
+			return
+		}
+		s.serveKV(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveACL serves the ACL endpoints. Requests for secondary datacenters are served by the primary
+// datacenter, except for the replication endpoint.
+func (s *Server) serveACL(w http.ResponseWriter, r *http.Request, secondary *datacenter) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/acl/")
+	endpoint, id := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		endpoint, id = path[:i], path[i+1:]
+	}
+
+	method, exists := endpointMethods[endpoint]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch endpoint {
+	case "bootstrap":
+		s.bootstrap(w)
+	case "create":
+		s.write(w, r, false)
+	case "update":
+		s.write(w, r, true)
+	case "destroy":
+		s.destroy(w, id)
+	case "clone":
+		s.clone(w, id)
+	case "info":
+		s.query(w, r, func() interface{} {
+			entries := []*api.ACLEntry{}
+			if token, exists := s.tokens[id]; exists {
+				copied := *token
+				entries = append(entries, &copied)
+			}
+			return entries
+		})
+	case "list":
+		s.query(w, r, func() interface{} {
+			return s.list()
+		})
+	case "replication":
+		s.query(w, r, func() interface{} {
+			if secondary != nil {
+				return secondary.status(s.Datacenter, s.index)
+			}
+			status := s.replication
+			return &status
+		})
+	}
+}
+
+// status advances the replicated index and returns the replication status
+func (dc *datacenter) status(source string, index uint64) *api.ACLReplicationStatus {
+	if dc.step == 0 {
+		return &api.ACLReplicationStatus{}
+	}
+	if dc.replicated += dc.step; dc.replicated > index {
+		dc.replicated = index
+	}
+	return &api.ACLReplicationStatus{
+		Enabled:          true,
+		Running:          true,
+		SourceDatacenter: source,
+		ReplicatedIndex:  dc.replicated,
+		LastSuccess:      time.Now().UTC(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) bootstrap(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bootstrapped {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	s.bootstrapped = true
+	id := s.set(api.ACLEntry{Name: "Bootstrap Token", Type: api.ACLManagementType})
+	writeJSON(w, map[string]string{"ID": id})
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, update bool) {
+	var entry api.ACLEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, fmt.Sprintf("Request decode failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	if update && entry.ID == "" {
+		http.Error(w, "ACL ID must be set", http.StatusBadRequest)
+		return
+	}
+	switch entry.Type {
+	case "", api.ACLClientType, api.ACLManagementType:
+	default:
+		http.Error(w, fmt.Sprintf("Invalid ACL Type %q", entry.Type), http.StatusInternalServerError)
+		return
+	}
+	if _, err := consulacl.NewPolicyFromRules(entry.Rules); err != nil {
+		http.Error(w, fmt.Sprintf("ACL rule compilation failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, map[string]string{"ID": s.set(entry)})
+}
+
+func (s *Server) destroy(w http.ResponseWriter, id string) {
+	if id == "" {
+		http.Error(w, "Missing ACL", http.StatusBadRequest)
+		return
+	}
+
+	s.DeleteToken(id)
+	writeJSON(w, true)
+}
+
+func (s *Server) clone(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		http.Error(w, "ACL not found", http.StatusNotFound)
+		return
+	}
+	clone := *token
+	clone.ID = ""
+	writeJSON(w, map[string]string{"ID": s.set(clone)})
+}
+
+// query serves a read endpoint with support for blocking queries. The result function is called while
+// holding the lock, a nil result is reported as not found.
+func (s *Server) query(w http.ResponseWriter, r *http.Request, result func() interface{}) {
+	q := r.URL.Query()
+	waitIndex, _ := strconv.ParseUint(q.Get("index"), 10, 64)
+	wait := s.MaxWait
+	if waitParam := q.Get("wait"); waitParam != "" {
+		if d, err := time.ParseDuration(waitParam); err == nil && d < wait {
+			wait = d
+		}
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	s.mu.Lock()
+	for waitIndex > 0 && s.index <= waitIndex && !s.closed {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+			s.mu.Lock()
+			continue
+		case <-timeout.C:
+		case <-r.Context().Done():
+			return
+		}
+		s.mu.Lock()
+		break
+	}
+	index := s.index
+	v := result()
+	s.mu.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	w.Header().Set("X-Consul-KnownLeader", "true")
+	w.Header().Set("X-Consul-LastContact", "0")
+	if v == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, v)
+}
@@ -0,0 +1,264 @@
+package consulacltest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Bootstrap(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	id, _, err := acl.Bootstrap()
+	require.NoError(t, err)
+	token := s.Token(id)
+	require.NotNil(t, token)
+	assert.EqualValues(t, api.ACLManagementType, token.Type)
+
+	_, _, err = acl.Bootstrap()
+	assert.Error(t, err)
+}
+
+func TestServer_CreateUpdate(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	id, _, err := acl.Create(&api.ACLEntry{Name: "web", Rules: `service "web" { policy = "write" }`}, nil)
+	require.NoError(t, err)
+	assert.Len(t, id, 36)
+
+	entry, meta, err := acl.Info(id, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, "web", entry.Name)
+	assert.EqualValues(t, api.ACLClientType, entry.Type)
+	assert.EqualValues(t, meta.LastIndex, entry.CreateIndex)
+	assert.EqualValues(t, meta.LastIndex, entry.ModifyIndex)
+
+	// Creating with an ID uses the ID
+	_, _, err = acl.Create(&api.ACLEntry{ID: "fixed", Name: "fixed"}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, s.Token("fixed"))
+
+	entry.Rules = `service "web" { policy = "read" }`
+	_, err = acl.Update(entry, nil)
+	require.NoError(t, err)
+	updated := s.Token(id)
+	assert.EqualValues(t, entry.Rules, updated.Rules)
+	assert.EqualValues(t, entry.CreateIndex, updated.CreateIndex)
+	assert.True(t, updated.ModifyIndex > entry.ModifyIndex)
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, _, err := acl.Create(&api.ACLEntry{Name: "invalid", Rules: `service "web" {`}, nil)
+		assert.Error(t, err)
+		_, _, err = acl.Create(&api.ACLEntry{Name: "invalid", Rules: `service "web" { policy = "invalid" }`}, nil)
+		assert.Error(t, err)
+		_, _, err = acl.Create(&api.ACLEntry{Name: "invalid", Type: "other"}, nil)
+		assert.Error(t, err)
+		_, err = acl.Update(&api.ACLEntry{Name: "invalid"}, nil)
+		assert.Error(t, err)
+		assert.Len(t, s.Tokens(), 2)
+	})
+}
+
+func TestServer_CloneDestroy(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	id := s.SetToken(&api.ACLEntry{Name: "web", Rules: `service "web" { policy = "write" }`})
+	cloneID, _, err := acl.Clone(id, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, cloneID)
+	clone := s.Token(cloneID)
+	require.NotNil(t, clone)
+	assert.EqualValues(t, "web", clone.Name)
+	assert.EqualValues(t, `service "web" { policy = "write" }`, clone.Rules)
+
+	_, _, err = acl.Clone("missing", nil)
+	assert.Error(t, err)
+
+	index := s.Index()
+	_, err = acl.Destroy(id, nil)
+	require.NoError(t, err)
+	assert.Nil(t, s.Token(id))
+	assert.True(t, s.Index() > index)
+
+	entry, _, err := acl.Info(id, nil)
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+
+	// Destroying missing tokens succeeds
+	_, err = acl.Destroy(id, nil)
+	assert.NoError(t, err)
+
+	s.DeleteToken(cloneID)
+	assert.Empty(t, s.Tokens())
+}
+
+func TestServer_List(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	s.SetToken(&api.ACLEntry{ID: "b", Name: "b"})
+	s.SetToken(&api.ACLEntry{ID: "a", Name: "a"})
+
+	entries, meta, err := acl.List(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.EqualValues(t, "a", entries[0].ID)
+	assert.EqualValues(t, "b", entries[1].ID)
+	assert.EqualValues(t, s.Index(), meta.LastIndex)
+	assert.True(t, meta.KnownLeader)
+}
+
+func TestServer_BlockingQuery(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	_, meta, err := acl.List(nil)
+	require.NoError(t, err)
+
+	t.Run("Change", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			s.SetToken(&api.ACLEntry{ID: "a"})
+		}()
+
+		start := time.Now()
+		entries, newMeta, err := acl.List(&api.QueryOptions{WaitIndex: meta.LastIndex, WaitTime: 5 * time.Second})
+		require.NoError(t, err)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.Len(t, entries, 1)
+		assert.True(t, newMeta.LastIndex > meta.LastIndex)
+		meta = newMeta
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		entry, newMeta, err := acl.Info("a", &api.QueryOptions{WaitIndex: meta.LastIndex, WaitTime: 50 * time.Millisecond})
+		require.NoError(t, err)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.NotNil(t, entry)
+		assert.EqualValues(t, meta.LastIndex, newMeta.LastIndex)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		s := NewServer()
+		done := make(chan struct{})
+		go func() {
+			s.Client().ACL().List(&api.QueryOptions{WaitIndex: s.Index(), WaitTime: time.Minute})
+			close(done)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		s.Close()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "blocking query not released")
+		}
+	})
+}
+
+func TestServer_Replication(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	status, _, err := acl.Replication(nil)
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+
+	s.SetReplication(api.ACLReplicationStatus{Enabled: true, Running: true, SourceDatacenter: "dc1", ReplicatedIndex: 42})
+	status, _, err = acl.Replication(nil)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.EqualValues(t, 42, status.ReplicatedIndex)
+}
+
+func TestServer_AddDatacenter(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddDatacenter("dc2", 2)
+	s.AddDatacenter("dc3", 0)
+	acl := s.Client().ACL()
+
+	s.SetToken(&api.ACLEntry{ID: "a"})
+	s.SetToken(&api.ACLEntry{ID: "b"})
+	index := s.Index()
+
+	// Replication advances by the step on every request, up to the index of the server
+	for _, expected := range []uint64{2, index} {
+		status, _, err := acl.Replication(&api.QueryOptions{Datacenter: "dc2"})
+		require.NoError(t, err)
+		assert.True(t, status.Enabled)
+		assert.EqualValues(t, "dc1", status.SourceDatacenter)
+		assert.EqualValues(t, expected, status.ReplicatedIndex)
+	}
+
+	status, _, err := acl.Replication(&api.QueryOptions{Datacenter: "dc3"})
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+
+	// Other requests are served by the primary datacenter
+	entries, _, err := acl.List(&api.QueryOptions{Datacenter: "dc2"})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, _, err = acl.List(&api.QueryOptions{Datacenter: "dc1"})
+	require.NoError(t, err)
+	_, _, err = acl.Replication(&api.QueryOptions{Datacenter: "dc4"})
+	assert.Error(t, err)
+}
+
+func TestServer_FailNext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	acl := s.Client().ACL()
+
+	s.FailNext(2)
+	for i := 0; i < 2; i++ {
+		_, _, err := acl.List(nil)
+		assert.Error(t, err)
+	}
+	_, _, err := acl.List(nil)
+	assert.NoError(t, err)
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddDatacenter("dc2", 1)
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/v1/kv/test", http.StatusNotFound},
+		{http.MethodGet, "/v1/kv/test?dc=dc2", http.StatusBadRequest},
+		{http.MethodGet, "/v1/acl/list?dc=unknown", http.StatusInternalServerError},
+		{http.MethodGet, "/v1/txn", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/v1/kv/test", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/status/leader", http.StatusNotFound},
+		{http.MethodGet, "/v1/acl/unknown", http.StatusNotFound},
+		{http.MethodGet, "/v1/acl/create", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/v1/acl/list", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/v1/acl/destroy/", http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(tc.method, s.URL+tc.path, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.EqualValues(t, tc.code, resp.StatusCode, "%s %s", tc.method, tc.path)
+	}
+}
@@ -0,0 +1,335 @@
+package consulacl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// DriftType defines the type of a drift between desired policies and live tokens
+type DriftType uint8
+
+// String returns the string representation of a drift type
+func (t DriftType) String() string {
+	typeName, ok := driftTypeNameMap[t]
+	if !ok {
+		panic("invalid drift type")
+	}
+	return typeName
+}
+
+const (
+	// DriftMissing defines that no token exists for a desired policy
+	DriftMissing DriftType = iota
+	// DriftModified defines that the rules of a token differ from its desired policy
+	DriftModified
+	// DriftUnmanaged defines that a token exists without a desired policy
+	DriftUnmanaged
+
+	driftTypeMax
+)
+
+var driftTypeNameMap = map[DriftType]string{
+	DriftMissing:   "missing",
+	DriftModified:  "modified",
+	DriftUnmanaged: "unmanaged",
+}
+
+// DriftEvent describes a single drift detected by a Reconciler
+type DriftEvent struct {
+	Type DriftType
+	// Name is the policy name of the token
+	Name string
+	// ID is the ID of the live token, empty if the token is missing
+	ID string
+	// Desired is the desired policy, nil if the token is unmanaged
+	Desired *Policy
+	// Live is the policy of the live token, nil if the token is missing or its rules are invalid
+	Live *Policy
+	// Changes holds the changes required to turn the live policy into the desired one
+	Changes []RuleChange
+	// Violations holds the constraint violations of the desired policy, see Reconciler.Constraints
+	Violations []Violation
+	// Remediated defines if the drift has been remediated
+	Remediated bool
+	// Err holds the error which occurred while parsing the live rules or remediating the drift
+	Err error
+}
+
+// MarshalJSON implements json.Marshaler
+func (e DriftEvent) MarshalJSON() ([]byte, error) {
+	changes := make([]string, len(e.Changes))
+	for i, change := range e.Changes {
+		changes[i] = change.String()
+	}
+
+	violations := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		violations[i] = violation.String()
+	}
+
+	var errMessage string
+	if e.Err != nil {
+		errMessage = e.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		Type       string   `json:"type"`
+		Name       string   `json:"name"`
+		ID         string   `json:"id,omitempty"`
+		Changes    []string `json:"changes"`
+		Violations []string `json:"violations,omitempty"`
+		Remediated bool     `json:"remediated"`
+		Error      string   `json:"error,omitempty"`
+	}{
+		Type:       e.Type.String(),
+		Name:       e.Name,
+		ID:         e.ID,
+		Changes:    changes,
+		Violations: violations,
+		Remediated: e.Remediated,
+		Error:      errMessage,
+	})
+}
+
+// DefaultReconcilerInterval defines the default interval between two syncs of a Reconciler
+const DefaultReconcilerInterval = time.Minute
+
+// Reconciler compares desired policies against the live tokens of a consul cluster
+//
+// Tokens are compared semantically, see Policy.Normalize, so redundant rules do not cause drift.
+type Reconciler struct {
+	// Interval defines the interval between two syncs of Run
+	Interval time.Duration
+	// Key derives the policy name of live tokens, ACLEntryName if nil
+	Key ACLEntryKeyFunc
+	// Remediate enables updating modified tokens and creating missing client tokens. Unmanaged tokens
+	// are never touched.
+	Remediate bool
+	// Constraints are checked against the desired policies of drifted tokens. Remediation is refused for
+	// violating policies, the event reports a ConstraintError instead.
+	Constraints Constraints
+	// OnDrift is called for every drift event, if set
+	OnDrift func(event DriftEvent)
+	// OnError is called for every failed sync, if set
+	OnError func(err error)
+
+	acl     *api.ACL
+	desired *PolicySet
+
+	mu           sync.Mutex
+	drift        map[DriftType]int
+	lastSync     time.Time
+	lastSuccess  bool
+	syncErrors   uint64
+	remediations uint64
+}
+
+// NewReconciler constructs a new reconciler comparing the desired policy set against the tokens of the ACL client
+func NewReconciler(acl *api.ACL, desired *PolicySet) *Reconciler {
+	return &Reconciler{
+		Interval: DefaultReconcilerInterval,
+		acl:      acl,
+		desired:  desired,
+	}
+}
+
+// Sync compares the desired policies against the live tokens once and returns the detected drift
+//
+// Events are sorted by name and token ID. If remediation is enabled, failed remediations are reported
+// by the Err field of the respective event.
+func (r *Reconciler) Sync() ([]DriftEvent, error) {
+	events, err := r.sync()
+
+	r.mu.Lock()
+	r.lastSync = time.Now()
+	r.lastSuccess = err == nil
+	if err != nil {
+		r.syncErrors++
+	} else {
+		r.drift = make(map[DriftType]int)
+		for _, event := range events {
+			if !event.Remediated {
+				r.drift[event.Type]++
+			} else {
+				r.remediations++
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if r.OnDrift != nil {
+		for _, event := range events {
+			r.OnDrift(event)
+		}
+	}
+	return events, nil
+}
+
+func (r *Reconciler) sync() ([]DriftEvent, error) {
+	key := r.Key
+	if key == nil {
+		key = ACLEntryName
+	}
+
+	entries, _, err := r.acl.List(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []DriftEvent
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name := key(entry)
+		seen[name] = true
+
+		desired := r.desired.Get(name)
+		if desired == nil {
+			event := DriftEvent{Type: DriftUnmanaged, Name: name, ID: entry.ID}
+			event.Live, event.Err = NewPolicyFromRules(entry.Rules)
+			events = append(events, event)
+			continue
+		}
+
+		live, parseErr := NewPolicyFromRules(entry.Rules)
+		if parseErr == nil && live.Normalize().Equals(desired.Normalize()) {
+			continue
+		}
+
+		event := DriftEvent{
+			Type:    DriftModified,
+			Name:    name,
+			ID:      entry.ID,
+			Desired: desired,
+			Live:    live,
+			Changes: Diff(live, desired),
+			Err:     parseErr,
+		}
+		event.Violations = r.Constraints.Check(name, desired)
+		if r.Remediate && len(event.Violations) > 0 {
+			event.Err = &ConstraintError{Violations: event.Violations}
+		} else if r.Remediate {
+			update := *entry
+			update.Rules = desired.GenerateRules()
+			if _, err := r.acl.Update(&update, nil); err != nil {
+				event.Err = err
+			} else {
+				event.Remediated, event.Err = true, nil
+			}
+		}
+		events = append(events, event)
+	}
+
+	for _, name := range r.desired.Names() {
+		if seen[name] {
+			continue
+		}
+
+		desired := r.desired.Get(name)
+		event := DriftEvent{
+			Type:    DriftMissing,
+			Name:    name,
+			Desired: desired,
+			Changes: Diff(nil, desired),
+		}
+		event.Violations = r.Constraints.Check(name, desired)
+		if r.Remediate && len(event.Violations) > 0 {
+			event.Err = &ConstraintError{Violations: event.Violations}
+		} else if r.Remediate {
+			id, _, err := r.acl.Create(&api.ACLEntry{Name: name, Type: api.ACLClientType, Rules: desired.GenerateRules()}, nil)
+			if err != nil {
+				event.Err = err
+			} else {
+				event.ID, event.Remediated = id, true
+			}
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Name != events[j].Name {
+			return events[i].Name < events[j].Name
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// Run syncs every Interval until the context is done
+//
+// Failed syncs are reported to OnError and retried at the next interval. Run returns the error of the context.
+func (r *Reconciler) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReconcilerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sync(); err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler by writing the metrics of the reconciler in the Prometheus text format
+func (r *Reconciler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, r.Metrics())
+}
+
+// Metrics returns the metrics of the reconciler in the Prometheus text format
+func (r *Reconciler) Metrics() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b bytes.Buffer
+	b.WriteString("# HELP consulacl_drift_tokens Number of tokens which drifted from their desired policy during the last successful sync.\n")
+	b.WriteString("# TYPE consulacl_drift_tokens gauge\n")
+	for driftType := DriftMissing; driftType < driftTypeMax; driftType++ {
+		fmt.Fprintf(&b, "consulacl_drift_tokens{type=%q} %d\n", driftType.String(), r.drift[driftType])
+	}
+
+	var lastSync float64
+	if !r.lastSync.IsZero() {
+		lastSync = float64(r.lastSync.UnixNano()) / 1e9
+	}
+	b.WriteString("# HELP consulacl_last_sync_timestamp_seconds Time of the last sync.\n")
+	b.WriteString("# TYPE consulacl_last_sync_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "consulacl_last_sync_timestamp_seconds %g\n", lastSync)
+
+	lastSuccess := 0
+	if r.lastSuccess {
+		lastSuccess = 1
+	}
+	b.WriteString("# HELP consulacl_last_sync_success Whether the last sync succeeded.\n")
+	b.WriteString("# TYPE consulacl_last_sync_success gauge\n")
+	fmt.Fprintf(&b, "consulacl_last_sync_success %d\n", lastSuccess)
+
+	b.WriteString("# HELP consulacl_sync_errors_total Number of failed syncs.\n")
+	b.WriteString("# TYPE consulacl_sync_errors_total counter\n")
+	fmt.Fprintf(&b, "consulacl_sync_errors_total %d\n", r.syncErrors)
+
+	b.WriteString("# HELP consulacl_remediations_total Number of remediated tokens.\n")
+	b.WriteString("# TYPE consulacl_remediations_total counter\n")
+	fmt.Fprintf(&b, "consulacl_remediations_total %d\n", r.remediations)
+
+	return b.String()
+}
@@ -0,0 +1,195 @@
+package consulacl_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// driftedTokens returns tokens which drifted from testPolicySet
+func driftedTokens() []*api.ACLEntry {
+	return []*api.ACLEntry{
+		// Semantically equal to the desired policy
+		{ID: "1", Name: "app", Rules: `key "app/" { policy = "write" } key "app/sub/" { policy = "write" }`},
+		{ID: "2", Name: "web", Rules: `service "web" { policy = "read" }`},
+		{ID: "3", Name: "legacy", Rules: `operator = "write"`},
+	}
+}
+
+func TestDriftType_String(t *testing.T) {
+	for driftType := consulacl.DriftMissing; driftType < consulacl.DriftTypeMax; driftType++ {
+		assert.NotEmpty(t, driftType.String())
+	}
+	assert.Panics(t, func() {
+		_ = consulacl.DriftTypeMax.String()
+	})
+}
+
+func TestDriftEvent_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(consulacl.DriftEvent{
+		Type:    consulacl.DriftModified,
+		Name:    "web",
+		ID:      "2",
+		Changes: []consulacl.RuleChange{{Resource: consulacl.ResourceService, Target: "web", Old: consulacl.GrantRead, New: consulacl.GrantWrite}},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type": "modified", "name": "web", "id": "2", "changes": ["~ service \"web\" = \"read\" -> \"write\""], "remediated": false}`, string(data))
+}
+
+func TestReconciler_Sync(t *testing.T) {
+	t.Run("Detect", func(t *testing.T) {
+		server := newTestServer(driftedTokens()...)
+		defer server.Close()
+		r := consulacl.NewReconciler(server.Client().ACL(), testPolicySet())
+
+		var reported []consulacl.DriftEvent
+		r.OnDrift = func(event consulacl.DriftEvent) {
+			reported = append(reported, event)
+		}
+
+		events, err := r.Sync()
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.EqualValues(t, events, reported)
+
+		assert.EqualValues(t, consulacl.DriftMissing, events[0].Type)
+		assert.EqualValues(t, "db", events[0].Name)
+		assert.Empty(t, events[0].ID)
+
+		assert.EqualValues(t, consulacl.DriftUnmanaged, events[1].Type)
+		assert.EqualValues(t, "legacy", events[1].Name)
+		assert.EqualValues(t, consulacl.GrantWrite, events[1].Live.GetOperator())
+
+		assert.EqualValues(t, consulacl.DriftModified, events[2].Type)
+		assert.EqualValues(t, "web", events[2].Name)
+		assert.EqualValues(t, "2", events[2].ID)
+		assert.EqualValues(t, []consulacl.RuleChange{{Resource: consulacl.ResourceService, Target: "web", Old: consulacl.GrantRead, New: consulacl.GrantWrite}}, events[2].Changes)
+		assert.False(t, events[2].Remediated)
+
+		metrics := r.Metrics()
+		assert.Contains(t, metrics, `consulacl_drift_tokens{type="missing"} 1`+"\n")
+		assert.Contains(t, metrics, `consulacl_drift_tokens{type="modified"} 1`+"\n")
+		assert.Contains(t, metrics, `consulacl_drift_tokens{type="unmanaged"} 1`+"\n")
+		assert.Contains(t, metrics, "consulacl_last_sync_success 1\n")
+	})
+
+	t.Run("Remediate", func(t *testing.T) {
+		server := newTestServer(driftedTokens()...)
+		defer server.Close()
+		r := consulacl.NewReconciler(server.Client().ACL(), testPolicySet())
+		r.Remediate = true
+
+		events, err := r.Sync()
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.True(t, events[0].Remediated)
+		created := server.Token(events[0].ID)
+		require.NotNil(t, created)
+		assert.EqualValues(t, "db", created.Name)
+		assert.False(t, events[1].Remediated)
+		assert.True(t, events[2].Remediated)
+		assert.Contains(t, r.Metrics(), "consulacl_remediations_total 2\n")
+
+		// Only the unmanaged token remains
+		events, err = r.Sync()
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.EqualValues(t, consulacl.DriftUnmanaged, events[0].Type)
+	})
+
+	t.Run("Constraints", func(t *testing.T) {
+		server := newTestServer(driftedTokens()...)
+		defer server.Close()
+		r := consulacl.NewReconciler(server.Client().ACL(), testPolicySet())
+		r.Remediate = true
+		r.Constraints = consulacl.Constraints{
+			{Name: "service-read", Resource: consulacl.ResourceService, MaxGrant: consulacl.GrantRead, Except: []string{"db"}},
+		}
+
+		events, err := r.Sync()
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+
+		// Remediation of the violating policy is refused
+		assert.True(t, events[0].Remediated)
+		assert.Empty(t, events[0].Violations)
+		assert.EqualValues(t, "web", events[2].Name)
+		assert.False(t, events[2].Remediated)
+		require.Len(t, events[2].Violations, 1)
+		assert.EqualValues(t, "service-read", events[2].Violations[0].Constraint)
+		require.IsType(t, &consulacl.ConstraintError{}, events[2].Err)
+		assert.EqualValues(t, events[2].Violations, events[2].Err.(*consulacl.ConstraintError).Violations)
+		assert.EqualValues(t, `service "web" { policy = "read" }`, server.Token("2").Rules)
+
+		data, err := json.Marshal(events[2])
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"violations":["web: service \"web\" = \"write\" violates service-read: grant exceeds \"read\""]`)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		server := newTestServer()
+		defer server.Close()
+		server.FailNext(1)
+		r := consulacl.NewReconciler(server.Client().ACL(), testPolicySet())
+
+		_, err := r.Sync()
+		assert.Error(t, err)
+		metrics := r.Metrics()
+		assert.Contains(t, metrics, "consulacl_sync_errors_total 1\n")
+		assert.Contains(t, metrics, "consulacl_last_sync_success 0\n")
+	})
+}
+
+func TestReconciler_Run(t *testing.T) {
+	server := newTestServer(driftedTokens()...)
+	defer server.Close()
+	server.FailNext(1)
+	r := consulacl.NewReconciler(server.Client().ACL(), testPolicySet())
+	r.Interval = 10 * time.Millisecond
+
+	errs := make(chan error, 1)
+	r.OnError = func(err error) {
+		errs <- err
+	}
+	drift := make(chan consulacl.DriftEvent, 16)
+	r.OnDrift = func(event consulacl.DriftEvent) {
+		drift <- event
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	assert.Error(t, <-errs)
+	event := <-drift
+	assert.EqualValues(t, "db", event.Name)
+
+	cancel()
+	assert.EqualError(t, <-done, context.Canceled.Error())
+}
+
+func TestReconciler_ServeHTTP(t *testing.T) {
+	server := newTestServer(driftedTokens()...)
+	defer server.Close()
+	r := consulacl.NewReconciler(server.Client().ACL(), testPolicySet())
+
+	_, err := r.Sync()
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.EqualValues(t, 200, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, recorder.Body.String(), "# TYPE consulacl_drift_tokens gauge\n")
+	assert.Contains(t, recorder.Body.String(), "consulacl_last_sync_timestamp_seconds ")
+}
@@ -0,0 +1,17 @@
+package consulacl
+
+import (
+	"time"
+)
+
+// Unexported identifiers used by the tests of package consulacl_test
+const (
+	ACLEventTypeMax  = aclEventTypeMax
+	DriftTypeMax     = driftTypeMax
+	RotationStateMax = rotationStateMax
+)
+
+// NextBackoff exports ACLWatcher.nextBackoff for tests
+func (w *ACLWatcher) NextBackoff(backoff time.Duration) time.Duration {
+	return w.nextBackoff(backoff)
+}
@@ -0,0 +1,30 @@
+//go:build gofuzz
+// +build gofuzz
+
+package consulacl
+
+// Fuzz implements the go-fuzz entry point
+//
+// Valid rules are parsed into a policy, regenerated and parsed again. The regenerated policy has to
+// equal the parsed one and normalizing has to be idempotent.
+func Fuzz(data []byte) int {
+	p, err := NewPolicyFromRules(string(data))
+	if err != nil {
+		return 0
+	}
+
+	rules := p.GenerateRules()
+	parsed, err := NewPolicyFromRules(rules)
+	if err != nil {
+		panic("generated rules do not parse: " + err.Error() + "\n" + rules)
+	}
+	if !parsed.Equals(p) {
+		panic("generated rules do not round-trip:\n" + rules)
+	}
+
+	normalized := p.Normalize()
+	if !normalized.Normalize().Equals(normalized) {
+		panic("normalize is not idempotent:\n" + rules)
+	}
+	return 1
+}
@@ -11,6 +11,9 @@ import (
 type GrantMap struct {
 	mu     sync.RWMutex
 	grants map[string]Grant
+
+	observers      []grantObserver
+	nextObserverID uint64
 }
 
 // Set applies the given grant for the given target
@@ -23,23 +26,32 @@ func (gm *GrantMap) Set(target string, grant Grant) {
 		return
 	}
 	gm.mu.Lock()
-	defer gm.mu.Unlock()
 	if gm.grants == nil {
 		gm.grants = make(map[string]Grant, 16)
 	}
+	old := gm.grants[target]
 	gm.grants[target] = grant
+	observers := gm.observers
+	gm.mu.Unlock()
+
+	if old != grant {
+		notifyGrantObservers(observers, GrantChange{Type: ChangeSet, Target: target, Old: old, New: grant})
+	}
 }
 
 // Remove removes the grant for the given target
 func (gm *GrantMap) Remove(target string) {
 	gm.mu.Lock()
-	defer gm.mu.Unlock()
-	if gm.grants == nil {
-		return
-	}
-	if _, exists := gm.grants[target]; exists {
+	old, exists := gm.grants[target]
+	if exists {
 		delete(gm.grants, target)
 	}
+	observers := gm.observers
+	gm.mu.Unlock()
+
+	if exists {
+		notifyGrantObservers(observers, GrantChange{Type: ChangeRemove, Target: target, Old: old, New: GrantNone})
+	}
 }
 
 // Get retrieves the grant for a given target
@@ -55,26 +67,60 @@ func (gm *GrantMap) Is(target string, grant Grant) bool {
 	return g == grant
 }
 
+// Targets returns the sorted targets of all grants
+func (gm *GrantMap) Targets() []string {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	targets := make([]string, 0, len(gm.grants))
+	for target := range gm.grants {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// LongestPrefix retrieves the grant whose target is the longest prefix of the given target
+//
+// This resembles the matching consul applies when evaluating rules. If no target matches,
+// ok will be false.
+func (gm *GrantMap) LongestPrefix(target string) (prefix string, grant Grant, ok bool) {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	for candidate, candidateGrant := range gm.grants {
+		if candidateGrant == GrantNone || !strings.HasPrefix(target, candidate) {
+			continue
+		}
+		if !ok || len(candidate) > len(prefix) {
+			prefix, grant, ok = candidate, candidateGrant, true
+		}
+	}
+
+	return
+}
+
 // Equals checks if the given GrantMap equals another GrantMap
 func (gm *GrantMap) Equals(other *GrantMap) bool {
 	if other == nil {
 		return false
 	}
 
-	// Acquire read-lock on both grant maps
+	// Take a snapshot of the other grant map first, so only one lock is held at a time. Holding
+	// both locks would deadlock when comparing two grant maps with each other concurrently.
+	otherGrants := other.Clone().grants
+
 	gm.mu.RLock()
 	defer gm.mu.RUnlock()
-	other.mu.RLock()
-	defer other.mu.RUnlock()
 
 	// Short-cut: length mismatch
-	if len(gm.grants) != len(other.grants) {
+	if len(gm.grants) != len(otherGrants) {
 		return false
 	}
 
 	// Compare each grant
 	for target, grant := range gm.grants {
-		if other.grants[target] != grant {
+		if otherGrants[target] != grant {
 			return false
 		}
 	}
@@ -86,7 +132,11 @@ func (gm *GrantMap) Equals(other *GrantMap) bool {
 func (gm *GrantMap) Clone() *GrantMap {
 	gm.mu.RLock()
 	defer gm.mu.RUnlock()
+	return gm.cloneLocked()
+}
 
+// cloneLocked creates a copy of the GrantMap. The caller has to hold the lock.
+func (gm *GrantMap) cloneLocked() *GrantMap {
 	clone := &GrantMap{
 		grants: make(map[string]Grant, len(gm.grants)),
 	}
@@ -97,6 +147,33 @@ func (gm *GrantMap) Clone() *GrantMap {
 	return clone
 }
 
+// setLocked applies the given grant for the given target and returns the resulting change.
+// The caller has to hold the lock and has to notify the observers.
+func (gm *GrantMap) setLocked(target string, grant Grant) (GrantChange, bool) {
+	old := gm.grants[target]
+	if old == grant {
+		return GrantChange{}, false
+	}
+
+	if grant == GrantNone {
+		delete(gm.grants, target)
+		return GrantChange{Type: ChangeRemove, Target: target, Old: old, New: GrantNone}, true
+	}
+
+	if gm.grants == nil {
+		gm.grants = make(map[string]Grant, 16)
+	}
+	gm.grants[target] = grant
+	return GrantChange{Type: ChangeSet, Target: target, Old: old, New: grant}, true
+}
+
+// merge applies all grants of the other GrantMap
+func (gm *GrantMap) merge(other *GrantMap) {
+	for target, grant := range other.Clone().grants {
+		gm.Set(target, grant)
+	}
+}
+
 func (gm *GrantMap) generateRules(typePrefix string) string {
 	var rules []string
 
@@ -119,9 +196,9 @@ func (gm *GrantMap) generateRules(typePrefix string) string {
 		}
 
 		rules = append(rules, fmt.Sprintf(
-			`%s "%s" {
+			`%s %s {
   policy = "%s"
-}`, typePrefix, target, grant.String()))
+}`, typePrefix, quoteString(target), grant.String()))
 	}
 
 	return strings.Join(rules, "\n")
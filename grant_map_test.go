@@ -177,3 +177,60 @@ func TestGrantMap_Clone(t *testing.T) {
 	// Finally ensure that clone and source are not equal anymore
 	assert.False(t, clone.Equals(&source))
 }
+
+func TestGrantMap_LongestPrefix(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		gm := GrantMap{}
+		_, _, ok := gm.LongestPrefix("test")
+		assert.False(t, ok)
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		gm := GrantMap{}
+		gm.Set("other", GrantWrite)
+		_, _, ok := gm.LongestPrefix("test")
+		assert.False(t, ok)
+	})
+
+	t.Run("Longest", func(t *testing.T) {
+		gm := GrantMap{}
+		gm.Set("", GrantRead)
+		gm.Set("app/", GrantWrite)
+		gm.Set("app/secret", GrantDeny)
+
+		prefix, grant, ok := gm.LongestPrefix("app/config")
+		assert.True(t, ok)
+		assert.EqualValues(t, "app/", prefix)
+		assert.EqualValues(t, GrantWrite, grant)
+
+		prefix, grant, ok = gm.LongestPrefix("app/secrets/db")
+		assert.True(t, ok)
+		assert.EqualValues(t, "app/secret", prefix)
+		assert.EqualValues(t, GrantDeny, grant)
+
+		prefix, grant, ok = gm.LongestPrefix("other")
+		assert.True(t, ok)
+		assert.EqualValues(t, "", prefix)
+		assert.EqualValues(t, GrantRead, grant)
+	})
+
+	t.Run("SkipNone", func(t *testing.T) {
+		gm := GrantMap{}
+		gm.Set("app/", GrantWrite)
+		gm.grants["app/secret"] = GrantNone
+
+		prefix, grant, ok := gm.LongestPrefix("app/secret")
+		assert.True(t, ok)
+		assert.EqualValues(t, "app/", prefix)
+		assert.EqualValues(t, GrantWrite, grant)
+	})
+}
+
+func TestGrantMap_Targets(t *testing.T) {
+	gm := GrantMap{}
+	assert.Empty(t, gm.Targets())
+
+	gm.Set("target1", GrantRead)
+	gm.Set("target0", GrantWrite)
+	assert.EqualValues(t, []string{"target0", "target1"}, gm.Targets())
+}
@@ -0,0 +1,314 @@
+package consulacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Revision describes a single revision of a named policy
+type Revision struct {
+	// Number identifies the revision, starting at 1 for the first revision of a policy
+	Number  int
+	Author  string
+	Time    time.Time
+	Message string
+	// Policy is the policy as of the revision, nil if the policy was deleted
+	Policy *Policy
+	// Changes holds the differences to the previous revision
+	Changes []RuleChange
+	// Index is the store index of the revision, zero if the policy was deleted
+	Index uint64
+}
+
+// clone returns a copy of the revision
+func (r *Revision) clone() *Revision {
+	copied := *r
+	if r.Policy != nil {
+		copied.Policy = r.Policy.Clone()
+	}
+	copied.Changes = append([]RuleChange(nil), r.Changes...)
+	return &copied
+}
+
+// Attribution describes the revision of a named policy which introduced a grant
+type Attribution struct {
+	Name     string
+	Revision *Revision
+	Change   RuleChange
+}
+
+// History records revisions of named policies in a RevisionStore
+//
+// Revisions are kept by the store along with the policies. All modifications have to go through the
+// history to be recorded. Changes applied directly to the store are picked up as part of the next
+// revision's changes.
+type History struct {
+	// Now returns the time recorded for new revisions, time.Now if nil
+	Now func() time.Time
+
+	store RevisionStore
+	mu    sync.Mutex
+}
+
+// NewHistory constructs a new history on top of the given store
+func NewHistory(store RevisionStore) *History {
+	return &History{
+		store: store,
+	}
+}
+
+func (h *History) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// Commit stores the policy under the given name and records a new revision
+//
+// Committing a nil policy deletes the policy. ErrStoreConflict is returned if the policy has been
+// modified concurrently.
+func (h *History) Commit(name string, p *Policy, author, message string) (*Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var previous *Policy
+	var index uint64
+	current, err := h.store.Get(name)
+	if err == nil {
+		previous, index = current.Policy, current.Index
+	} else if err != ErrPolicyNotFound {
+		return nil, err
+	}
+	if p == nil && previous == nil {
+		return nil, ErrPolicyNotFound
+	}
+
+	revisions, err := h.store.Revisions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rev := &Revision{
+		Number:  len(revisions) + 1,
+		Author:  author,
+		Time:    h.now(),
+		Message: message,
+		Changes: Diff(previous, p),
+	}
+	if p != nil {
+		rev.Policy = p.Clone()
+	}
+	if rev.Index, err = h.store.Record(name, rev, index); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// Delete deletes the policy and records a new revision
+func (h *History) Delete(name, author, message string) (*Revision, error) {
+	return h.Commit(name, nil, author, message)
+}
+
+// Rollback restores the policy as of the given revision by committing it as a new revision
+//
+// An empty message is replaced by a message referencing the restored revision.
+func (h *History) Rollback(name string, number int, author, message string) (*Revision, error) {
+	rev, err := h.Revision(name, number)
+	if err != nil {
+		return nil, err
+	}
+	if message == "" {
+		message = fmt.Sprintf("rollback to revision %d", number)
+	}
+	return h.Commit(name, rev.Policy, author, message)
+}
+
+// Revisions returns all revisions of the policy, oldest first
+func (h *History) Revisions(name string) ([]*Revision, error) {
+	return h.store.Revisions(name)
+}
+
+// Revision returns a single revision of the policy
+func (h *History) Revision(name string, number int) (*Revision, error) {
+	revisions, err := h.store.Revisions(name)
+	if err != nil {
+		return nil, err
+	}
+	if number < 1 || number > len(revisions) {
+		return nil, fmt.Errorf("revision %d of policy %q not found", number, name)
+	}
+	return revisions[number-1], nil
+}
+
+// Names returns the sorted names of all policies with recorded revisions
+func (h *History) Names() ([]string, error) {
+	return h.store.Recorded()
+}
+
+// Blame returns the revision which set the current grant for a target of the given resource
+//
+// For global resources (keyring and operator) the target is ignored. nil is returned if the policy
+// holds no grant for the target.
+func (h *History) Blame(name string, resource Resource, target string) (*Revision, error) {
+	if resource.IsGlobal() {
+		target = ""
+	}
+
+	revisions, err := h.Revisions(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(revisions) - 1; i >= 0; i-- {
+		for _, change := range revisions[i].Changes {
+			if change.Resource != resource || change.Target != target {
+				continue
+			}
+			if change.New == GrantNone {
+				return nil, nil
+			}
+			return revisions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Granted returns every revision of every policy which set a target of the given resource to the grant
+//
+// For global resources (keyring and operator) the target is ignored. Attributions are sorted by time,
+// e.g. Granted(ResourceOperator, "", GrantWrite) tells who granted operator write access to which policy
+// and when.
+func (h *History) Granted(resource Resource, target string, grant Grant) ([]Attribution, error) {
+	if resource.IsGlobal() {
+		target = ""
+	}
+
+	names, err := h.Names()
+	if err != nil {
+		return nil, err
+	}
+
+	var attributions []Attribution
+	for _, name := range names {
+		revisions, err := h.Revisions(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range revisions {
+			for _, change := range rev.Changes {
+				if change.Resource == resource && change.Target == target && change.New == grant {
+					attributions = append(attributions, Attribution{Name: name, Revision: rev, Change: change})
+				}
+			}
+		}
+	}
+	sort.SliceStable(attributions, func(i, j int) bool {
+		return attributions[i].Revision.Time.Before(attributions[j].Revision.Time)
+	})
+	return attributions, nil
+}
+
+// historyChange is the JSON representation of a rule change
+type historyChange struct {
+	Resource string `json:"resource"`
+	Target   string `json:"target,omitempty"`
+	Old      string `json:"old"`
+	New      string `json:"new"`
+}
+
+// historyRevision is the JSON representation of a revision, as kept by stores and written by History.Save
+type historyRevision struct {
+	Name    string    `json:"name"`
+	Number  int       `json:"number"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	// Rules is nil if the policy was deleted
+	Rules   *string         `json:"rules"`
+	Changes []historyChange `json:"changes"`
+	Index   uint64          `json:"index"`
+}
+
+// newHistoryRevision returns the JSON representation of the revision
+func newHistoryRevision(name string, rev *Revision) historyRevision {
+	entry := historyRevision{
+		Name:    name,
+		Number:  rev.Number,
+		Author:  rev.Author,
+		Time:    rev.Time,
+		Message: rev.Message,
+		Changes: make([]historyChange, 0, len(rev.Changes)),
+		Index:   rev.Index,
+	}
+	if rev.Policy != nil {
+		rules := rev.Policy.GenerateRules()
+		entry.Rules = &rules
+	}
+	for _, change := range rev.Changes {
+		entry.Changes = append(entry.Changes, historyChange{
+			Resource: change.Resource.String(),
+			Target:   change.Target,
+			Old:      change.Old.String(),
+			New:      change.New.String(),
+		})
+	}
+	return entry
+}
+
+// revision returns the revision represented by the entry
+func (entry historyRevision) revision() (*Revision, error) {
+	rev := &Revision{
+		Number:  entry.Number,
+		Author:  entry.Author,
+		Time:    entry.Time,
+		Message: entry.Message,
+		Index:   entry.Index,
+	}
+	if entry.Rules != nil {
+		p, err := NewPolicyFromRules(*entry.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("revision %d of policy %q: %v", entry.Number, entry.Name, err)
+		}
+		rev.Policy = p
+	}
+	for _, change := range entry.Changes {
+		resource := ResourceByName(change.Resource)
+		if resource == ResourceNone {
+			return nil, fmt.Errorf("revision %d of policy %q: invalid resource %q", entry.Number, entry.Name, change.Resource)
+		}
+		rev.Changes = append(rev.Changes, RuleChange{
+			Resource: resource,
+			Target:   change.Target,
+			Old:      GrantByName(change.Old),
+			New:      GrantByName(change.New),
+		})
+	}
+	return rev, nil
+}
+
+// Save writes all recorded revisions to the writer as JSON
+func (h *History) Save(w io.Writer) error {
+	names, err := h.Names()
+	if err != nil {
+		return err
+	}
+
+	entries := []historyRevision{}
+	for _, name := range names {
+		revisions, err := h.Revisions(name)
+		if err != nil {
+			return err
+		}
+		for _, rev := range revisions {
+			entries = append(entries, newHistoryRevision(name, rev))
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
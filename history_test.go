@@ -0,0 +1,241 @@
+package consulacl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHistory() *History {
+	h := NewHistory(NewMemoryStore())
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	return h
+}
+
+func TestHistory_Commit(t *testing.T) {
+	h := newTestHistory()
+
+	p := NewPolicy()
+	p.Key().Set("app/", GrantRead)
+	rev, err := h.Commit("app", p, "alice", "initial")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, rev.Number)
+	assert.EqualValues(t, "alice", rev.Author)
+	assert.EqualValues(t, "initial", rev.Message)
+	assert.EqualValues(t, []RuleChange{{Resource: ResourceKey, Target: "app/", New: GrantRead}}, rev.Changes)
+
+	// The revision holds a copy of the policy
+	p.SetOperator(GrantWrite)
+	assert.EqualValues(t, GrantNone, rev.Policy.GetOperator())
+
+	rev, err = h.Commit("app", p, "bob", "operator access")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, rev.Number)
+	assert.EqualValues(t, []RuleChange{{Resource: ResourceOperator, New: GrantWrite}}, rev.Changes)
+
+	sp, err := h.store.Get("app")
+	require.NoError(t, err)
+	assert.True(t, sp.Policy.Equals(p))
+	assert.EqualValues(t, rev.Index, sp.Index)
+
+	revisions, err := h.Revisions("app")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	names, err := h.Names()
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"app"}, names)
+}
+
+func TestHistory_Persistent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	h := NewHistory(NewFileStore(dir))
+	p := NewPolicy()
+	p.SetOperator(GrantWrite)
+	committed, err := h.Commit("ops", p, "alice", "operator access")
+	require.NoError(t, err)
+
+	// A history on top of the same store sees the recorded revisions
+	h = NewHistory(NewFileStore(dir))
+	rev, err := h.Revision("ops", 1)
+	require.NoError(t, err)
+	assert.EqualValues(t, "alice", rev.Author)
+	assert.EqualValues(t, committed.Index, rev.Index)
+	assert.EqualValues(t, committed.Changes, rev.Changes)
+
+	rev, err = h.Commit("ops", NewPolicy(), "bob", "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, rev.Number)
+
+	// Revisions are recorded along with the policy, a concurrent commit of the same revision fails
+	sp, err := h.store.Get("ops")
+	require.NoError(t, err)
+	_, err = h.store.Record("ops", &Revision{Number: 2, Policy: p}, sp.Index)
+	assert.EqualError(t, err, ErrStoreConflict.Error())
+}
+
+func TestHistory_Delete(t *testing.T) {
+	h := newTestHistory()
+
+	_, err := h.Delete("app", "alice", "")
+	assert.EqualError(t, err, ErrPolicyNotFound.Error())
+
+	p := NewPolicy()
+	p.Service().Set("web", GrantWrite)
+	_, err = h.Commit("app", p, "alice", "")
+	require.NoError(t, err)
+
+	rev, err := h.Delete("app", "bob", "decommissioned")
+	require.NoError(t, err)
+	assert.Nil(t, rev.Policy)
+	assert.EqualValues(t, []RuleChange{{Resource: ResourceService, Target: "web", Old: GrantWrite}}, rev.Changes)
+
+	_, err = h.store.Get("app")
+	assert.EqualError(t, err, ErrPolicyNotFound.Error())
+}
+
+func TestHistory_Rollback(t *testing.T) {
+	h := newTestHistory()
+
+	p := NewPolicy()
+	p.Key().Set("app/", GrantRead)
+	_, err := h.Commit("app", p, "alice", "")
+	require.NoError(t, err)
+
+	p.Key().Set("app/", GrantWrite)
+	_, err = h.Commit("app", p, "bob", "")
+	require.NoError(t, err)
+
+	_, err = h.Rollback("app", 3, "carol", "")
+	assert.EqualError(t, err, `revision 3 of policy "app" not found`)
+
+	rev, err := h.Rollback("app", 1, "carol", "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, rev.Number)
+	assert.EqualValues(t, "rollback to revision 1", rev.Message)
+	assert.EqualValues(t, []RuleChange{{Resource: ResourceKey, Target: "app/", Old: GrantWrite, New: GrantRead}}, rev.Changes)
+
+	sp, err := h.store.Get("app")
+	require.NoError(t, err)
+	assert.EqualValues(t, GrantRead, sp.Policy.Key().Get("app/"))
+}
+
+func TestHistory_Conflict(t *testing.T) {
+	h := newTestHistory()
+	_, err := h.Commit("app", NewPolicy(), "alice", "")
+	require.NoError(t, err)
+
+	// Modify the stored policy behind the back of the history
+	sp, err := h.store.Get("app")
+	require.NoError(t, err)
+	sp.Policy.SetKeyring(GrantRead)
+	_, err = h.store.Put("app", sp.Policy, sp.Index)
+	require.NoError(t, err)
+
+	// The next revision is diffed against the stored policy
+	p := NewPolicy()
+	p.SetOperator(GrantRead)
+	rev, err := h.Commit("app", p, "bob", "")
+	require.NoError(t, err)
+	assert.EqualValues(t, []RuleChange{
+		{Resource: ResourceKeyring, Old: GrantRead},
+		{Resource: ResourceOperator, New: GrantRead},
+	}, rev.Changes)
+}
+
+func TestHistory_Blame(t *testing.T) {
+	h := newTestHistory()
+
+	p := NewPolicy()
+	p.Key().Set("app/", GrantRead)
+	first, err := h.Commit("app", p, "alice", "")
+	require.NoError(t, err)
+
+	p.SetOperator(GrantWrite)
+	second, err := h.Commit("app", p, "bob", "")
+	require.NoError(t, err)
+
+	blame := func(name string, resource Resource, target string) *Revision {
+		rev, err := h.Blame(name, resource, target)
+		require.NoError(t, err)
+		return rev
+	}
+	assert.EqualValues(t, first.Number, blame("app", ResourceKey, "app/").Number)
+	assert.EqualValues(t, second.Number, blame("app", ResourceOperator, "ignored").Number)
+	assert.Nil(t, blame("app", ResourceKey, "other/"))
+	assert.Nil(t, blame("other", ResourceKey, "app/"))
+
+	p.SetOperator(GrantNone)
+	_, err = h.Commit("app", p, "carol", "")
+	require.NoError(t, err)
+	assert.Nil(t, blame("app", ResourceOperator, ""))
+}
+
+func TestHistory_Granted(t *testing.T) {
+	h := newTestHistory()
+
+	p := NewPolicy()
+	p.SetOperator(GrantWrite)
+	_, err := h.Commit("ops", p, "alice", "")
+	require.NoError(t, err)
+
+	_, err = h.Commit("app", NewPolicy(), "bob", "")
+	require.NoError(t, err)
+	_, err = h.Commit("app", p, "carol", "temporary access")
+	require.NoError(t, err)
+
+	attributions, err := h.Granted(ResourceOperator, "", GrantWrite)
+	require.NoError(t, err)
+	require.Len(t, attributions, 2)
+	assert.EqualValues(t, "ops", attributions[0].Name)
+	assert.EqualValues(t, "alice", attributions[0].Revision.Author)
+	assert.EqualValues(t, "app", attributions[1].Name)
+	assert.EqualValues(t, "carol", attributions[1].Revision.Author)
+	assert.EqualValues(t, RuleChange{Resource: ResourceOperator, New: GrantWrite}, attributions[1].Change)
+
+	attributions, err = h.Granted(ResourceKeyring, "", GrantWrite)
+	require.NoError(t, err)
+	assert.Empty(t, attributions)
+}
+
+func TestHistory_Save(t *testing.T) {
+	h := newTestHistory()
+
+	var buf bytes.Buffer
+	require.NoError(t, h.Save(&buf))
+	assert.JSONEq(t, `[]`, buf.String())
+
+	p := NewPolicy()
+	p.Key().Set("app/", GrantRead)
+	rev, err := h.Commit("app", p, "alice", "initial")
+	require.NoError(t, err)
+	_, err = h.Delete("app", "bob", "")
+	require.NoError(t, err)
+
+	buf.Reset()
+	require.NoError(t, h.Save(&buf))
+	assert.JSONEq(t, fmt.Sprintf(`[
+		{
+			"name": "app", "number": 1, "author": "alice", "time": "2018-01-01T00:01:00Z", "message": "initial",
+			"rules": %q, "index": %d,
+			"changes": [{"resource": "key", "target": "app/", "old": "none", "new": "read"}]
+		},
+		{
+			"name": "app", "number": 2, "author": "bob", "time": "2018-01-01T00:02:00Z", "message": "",
+			"rules": null, "index": 0,
+			"changes": [{"resource": "key", "target": "app/", "old": "read", "new": "none"}]
+		}
+	]`, p.GenerateRules(), rev.Index), buf.String())
+}
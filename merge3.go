@@ -0,0 +1,84 @@
+package consulacl
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Conflict describes a target which has been changed to different grants on both sides of a merge
+type Conflict struct {
+	Resource Resource
+	// Target is the conflicting target. It is empty for global resources (keyring and operator).
+	Target string
+	Base   Grant
+	Ours   Grant
+	Theirs Grant
+}
+
+// String returns the string representation of a conflict
+func (c Conflict) String() string {
+	if c.Resource.IsGlobal() {
+		return fmt.Sprintf("%s: base %q, ours %q, theirs %q", c.Resource.String(), c.Base.String(), c.Ours.String(), c.Theirs.String())
+	}
+	return fmt.Sprintf("%s %q: base %q, ours %q, theirs %q", c.Resource.String(), c.Target, c.Base.String(), c.Ours.String(), c.Theirs.String())
+}
+
+type ruleKey struct {
+	resource Resource
+	target   string
+}
+
+// Merge3 merges two policies which have been derived from a common base policy
+//
+// Every target of every resource is merged on its own: changes applied on only one side are taken over,
+// identical changes on both sides are taken over once. If both sides changed a target to different grants
+// a Conflict is reported and the merged policy holds our grant for the target. Conflicts are sorted by
+// resource and target.
+func Merge3(base, ours, theirs *Policy) (*Policy, []Conflict) {
+	keys := make(map[ruleKey]bool)
+	collect := VisitorFunc(func(rule Rule) {
+		keys[ruleKey{rule.Resource, rule.Target}] = true
+	})
+	Walk(base, collect)
+	Walk(ours, collect)
+	Walk(theirs, collect)
+
+	sorted := make([]ruleKey, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].resource != sorted[j].resource {
+			return sorted[i].resource < sorted[j].resource
+		}
+		return sorted[i].target < sorted[j].target
+	})
+
+	merged := NewPolicy()
+	var conflicts []Conflict
+	for _, key := range sorted {
+		b := base.GetGrant(key.resource, key.target)
+		o := ours.GetGrant(key.resource, key.target)
+		t := theirs.GetGrant(key.resource, key.target)
+
+		grant := o
+		switch {
+		case o == t, t == b:
+			// Both sides agree or only we changed the target
+		case o == b:
+			// Only they changed the target
+			grant = t
+		default:
+			conflicts = append(conflicts, Conflict{
+				Resource: key.resource,
+				Target:   key.target,
+				Base:     b,
+				Ours:     o,
+				Theirs:   t,
+			})
+		}
+		merged.SetGrant(key.resource, key.target, grant)
+	}
+
+	return merged, conflicts
+}
@@ -0,0 +1,72 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflict_String(t *testing.T) {
+	assert.EqualValues(t, `operator: base "read", ours "write", theirs "deny"`, Conflict{
+		Resource: ResourceOperator,
+		Base:     GrantRead,
+		Ours:     GrantWrite,
+		Theirs:   GrantDeny,
+	}.String())
+	assert.EqualValues(t, `key "app/": base "none", ours "write", theirs "read"`, Conflict{
+		Resource: ResourceKey,
+		Target:   "app/",
+		Base:     GrantNone,
+		Ours:     GrantWrite,
+		Theirs:   GrantRead,
+	}.String())
+}
+
+func TestMerge3(t *testing.T) {
+	base := NewPolicy()
+	base.SetOperator(GrantRead)
+	base.SetKeyring(GrantRead)
+	base.Key().Set("shared/", GrantRead)
+	base.Key().Set("removed-ours/", GrantRead)
+	base.Key().Set("removed-theirs/", GrantRead)
+	base.Service().Set("web", GrantRead)
+
+	ours := base.Clone()
+	ours.SetOperator(GrantWrite)
+	ours.Key().Remove("removed-ours/")
+	ours.Key().Set("ours/", GrantWrite)
+	ours.Key().Set("both/", GrantWrite)
+	ours.Service().Set("web", GrantWrite)
+	ours.Node().Set("node0", GrantRead)
+
+	theirs := base.Clone()
+	theirs.SetOperator(GrantDeny)
+	theirs.SetKeyring(GrantWrite)
+	theirs.Key().Remove("removed-theirs/")
+	theirs.Key().Set("theirs/", GrantRead)
+	theirs.Key().Set("both/", GrantWrite)
+	theirs.Service().Set("web", GrantDeny)
+	theirs.Node().Set("node0", GrantWrite)
+
+	merged, conflicts := Merge3(base, ours, theirs)
+
+	assert.EqualValues(t, []Conflict{
+		{Resource: ResourceNode, Target: "node0", Base: GrantNone, Ours: GrantRead, Theirs: GrantWrite},
+		{Resource: ResourceService, Target: "web", Base: GrantRead, Ours: GrantWrite, Theirs: GrantDeny},
+		{Resource: ResourceOperator, Base: GrantRead, Ours: GrantWrite, Theirs: GrantDeny},
+	}, conflicts)
+
+	assert.EqualValues(t, GrantWrite, merged.GetKeyring())
+	assert.EqualValues(t, GrantWrite, merged.GetOperator())
+	assert.EqualValues(t, []string{"both/", "ours/", "shared/", "theirs/"}, merged.Key().Targets())
+	assert.EqualValues(t, GrantWrite, merged.Key().Get("both/"))
+	assert.EqualValues(t, GrantRead, merged.Key().Get("theirs/"))
+	assert.EqualValues(t, GrantWrite, merged.Service().Get("web"))
+	assert.EqualValues(t, GrantRead, merged.Node().Get("node0"))
+
+	t.Run("NoConflicts", func(t *testing.T) {
+		merged, conflicts := Merge3(base, base, base)
+		assert.Empty(t, conflicts)
+		assert.True(t, merged.Equals(base))
+	})
+}
@@ -0,0 +1,248 @@
+package consulacl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// DefaultReplicationPollInterval defines the default interval at which the replication status is polled
+const DefaultReplicationPollInterval = time.Second
+
+// DatacenterStatus describes the replication status of a secondary datacenter after an apply
+type DatacenterStatus struct {
+	Datacenter string
+	// ReplicatedIndex is the last replicated index reported by the datacenter
+	ReplicatedIndex uint64
+	// Lag is the number of indexes the datacenter was behind at the last poll
+	Lag uint64
+	// Synced defines if the datacenter replicated the applied index
+	Synced bool
+	// Duration is the time it took the datacenter to replicate the applied index, or the time waited for it
+	Duration time.Duration
+	// Err holds the error which prevented the datacenter from being synced
+	Err error
+}
+
+// ApplyResult describes the result of a multi-datacenter apply
+type ApplyResult struct {
+	// Index is the ACL index of the authoritative datacenter after the apply
+	Index uint64
+	// Created holds the names of the created tokens
+	Created []string
+	// Updated holds the names of the updated tokens
+	Updated []string
+	// Datacenters holds the replication status of the secondary datacenters, sorted by name
+	Datacenters []DatacenterStatus
+}
+
+// Synced checks if all secondary datacenters replicated the applied index
+func (r *ApplyResult) Synced() bool {
+	for _, status := range r.Datacenters {
+		if !status.Synced {
+			return false
+		}
+	}
+	return true
+}
+
+// MultiDCApplier applies policies to the authoritative datacenter and waits for their replication
+type MultiDCApplier struct {
+	// PollInterval defines the interval at which the replication status of the secondary datacenters is polled
+	PollInterval time.Duration
+	// MaxWait limits how long the replication of each secondary datacenter is waited for. Zero waits until
+	// the context is done, so the context should carry a deadline in that case.
+	MaxWait time.Duration
+	// Key derives the policy name of tokens, ACLEntryName if nil
+	Key ACLEntryKeyFunc
+	// Constraints are checked against all policies before anything is written. Apply fails with a
+	// ConstraintError if any policy violates them.
+	Constraints Constraints
+
+	acl           *api.ACL
+	authoritative string
+	secondaries   []string
+}
+
+// NewMultiDCApplier constructs a new applier for the given authoritative and secondary datacenters
+func NewMultiDCApplier(acl *api.ACL, authoritative string, secondaries ...string) *MultiDCApplier {
+	return &MultiDCApplier{
+		PollInterval:  DefaultReplicationPollInterval,
+		acl:           acl,
+		authoritative: authoritative,
+		secondaries:   secondaries,
+	}
+}
+
+// Apply writes the policies of the set to the tokens of the authoritative datacenter and waits until
+// every secondary datacenter replicated the resulting index
+//
+// Tokens whose policy already matches semantically are not written, missing tokens are created as
+// client tokens. Nothing is written if a policy violates the constraints or the key function derives
+// the name of a policy in the set for multiple tokens. Waiting for replication stops when the context is
+// done or MaxWait elapsed. An error is returned if a write fails or a secondary datacenter did not sync,
+// the result holds the progress made so far.
+func (a *MultiDCApplier) Apply(ctx context.Context, s *PolicySet) (*ApplyResult, error) {
+	key := a.Key
+	if key == nil {
+		key = ACLEntryName
+	}
+
+	var violations []Violation
+	for _, name := range s.Names() {
+		violations = append(violations, a.Constraints.Check(name, s.Get(name))...)
+	}
+	if len(violations) > 0 {
+		return nil, &ConstraintError{Violations: violations}
+	}
+	q := &api.QueryOptions{Datacenter: a.authoritative}
+	w := &api.WriteOptions{Datacenter: a.authoritative}
+
+	entries, _, err := a.acl.List(q.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]*api.ACLEntry, len(entries))
+	for _, entry := range entries {
+		name := key(entry)
+		// Duplicates only matter for managed policies, unnamed or legacy tokens are never touched
+		if _, exists := live[name]; exists && s.Get(name) != nil {
+			return nil, fmt.Errorf("duplicate policy name %q", name)
+		}
+		live[name] = entry
+	}
+
+	result := &ApplyResult{}
+	for _, name := range s.Names() {
+		desired := s.Get(name)
+		entry, exists := live[name]
+		if !exists {
+			if _, _, err := a.acl.Create(&api.ACLEntry{Name: name, Type: api.ACLClientType, Rules: desired.GenerateRules()}, w.WithContext(ctx)); err != nil {
+				return result, fmt.Errorf("create token for policy %q: %v", name, err)
+			}
+			result.Created = append(result.Created, name)
+			continue
+		}
+
+		if current, err := NewPolicyFromRules(entry.Rules); err == nil && current.Normalize().Equals(desired.Normalize()) {
+			continue
+		}
+		update := *entry
+		update.Rules = desired.GenerateRules()
+		if _, err := a.acl.Update(&update, w.WithContext(ctx)); err != nil {
+			return result, fmt.Errorf("update token %q of policy %q: %v", entry.ID, name, err)
+		}
+		result.Updated = append(result.Updated, name)
+	}
+
+	// The index of the ACL table covers all writes above
+	_, meta, err := a.acl.List(q.WithContext(ctx))
+	if err != nil {
+		return result, err
+	}
+	result.Index = meta.LastIndex
+
+	result.Datacenters = a.WaitReplication(ctx, result.Index)
+	if !result.Synced() {
+		var failed []string
+		for _, status := range result.Datacenters {
+			if !status.Synced {
+				failed = append(failed, fmt.Sprintf("%s: %v", status.Datacenter, status.Err))
+			}
+		}
+		return result, fmt.Errorf("replication incomplete: %s", strings.Join(failed, ", "))
+	}
+	return result, nil
+}
+
+// WaitReplication polls the replication status of all secondary datacenters until they replicated the
+// given index, the context is done or MaxWait elapsed
+//
+// Polling errors are retried, the last error is reported if the datacenter did not sync. Datacenters with
+// replication disabled fail right away as they never sync.
+func (a *MultiDCApplier) WaitReplication(ctx context.Context, index uint64) []DatacenterStatus {
+	if a.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.MaxWait)
+		defer cancel()
+	}
+
+	statuses := make([]DatacenterStatus, len(a.secondaries))
+	var wg sync.WaitGroup
+	for i, datacenter := range a.secondaries {
+		wg.Add(1)
+		go func(i int, datacenter string) {
+			defer wg.Done()
+			statuses[i] = a.waitDatacenter(ctx, datacenter, index)
+		}(i, datacenter)
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Datacenter < statuses[j].Datacenter
+	})
+	return statuses
+}
+
+func (a *MultiDCApplier) waitDatacenter(ctx context.Context, datacenter string, index uint64) DatacenterStatus {
+	interval := a.PollInterval
+	if interval <= 0 {
+		interval = DefaultReplicationPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	status := DatacenterStatus{
+		Datacenter: datacenter,
+		Lag:        index,
+	}
+	start := time.Now()
+	for {
+		q := &api.QueryOptions{Datacenter: datacenter}
+		replication, _, err := a.acl.Replication(q.WithContext(ctx))
+		if ctx.Err() != nil {
+			// Keep the result of the previous poll instead of the cancellation of the request
+			if status.Err == nil {
+				status.Err = ctx.Err()
+			}
+			status.Duration = time.Since(start)
+			return status
+		}
+
+		switch {
+		case err != nil:
+			status.Err = err
+		case !replication.Enabled:
+			status.Err = fmt.Errorf("replication disabled")
+			status.Duration = time.Since(start)
+			return status
+		default:
+			status.Err = nil
+			status.ReplicatedIndex = replication.ReplicatedIndex
+			status.Lag = 0
+			if replication.ReplicatedIndex < index {
+				status.Lag = index - replication.ReplicatedIndex
+			}
+		}
+
+		status.Duration = time.Since(start)
+		if status.Err == nil && status.Lag == 0 {
+			status.Synced = true
+			return status
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if status.Err == nil {
+				status.Err = ctx.Err()
+			}
+			return status
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package consulacl_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiDCApplier_Apply(t *testing.T) {
+	server := newTestServer(
+		&api.ACLEntry{ID: "1", Name: "web", Rules: `service "web" { policy = "read" }`},
+		&api.ACLEntry{ID: "2", Name: "app", Rules: `key "app/" { policy = "write" }`},
+	)
+	defer server.Close()
+	server.AddDatacenter("dc2", 1)
+	server.AddDatacenter("dc3", 100)
+	a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1", "dc3", "dc2")
+	a.PollInterval = 5 * time.Millisecond
+
+	result, err := a.Apply(context.Background(), testPolicySet())
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"db"}, result.Created)
+	assert.EqualValues(t, []string{"web"}, result.Updated)
+	assert.EqualValues(t, server.Index(), result.Index)
+	assert.True(t, result.Synced())
+
+	require.Len(t, result.Datacenters, 2)
+	for i, dc := range []string{"dc2", "dc3"} {
+		status := result.Datacenters[i]
+		assert.EqualValues(t, dc, status.Datacenter)
+		assert.True(t, status.Synced)
+		assert.NoError(t, status.Err)
+		assert.EqualValues(t, 0, status.Lag)
+		assert.EqualValues(t, result.Index, status.ReplicatedIndex)
+	}
+
+	assert.EqualValues(t, `service "web" {
+  policy = "write"
+}`, server.Token("1").Rules)
+}
+
+func TestMultiDCApplier_ApplyIncomplete(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.AddDatacenter("dc2", 100)
+	server.AddDatacenter("dc3", 0)
+	a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1", "dc2", "dc3", "dc4")
+	a.PollInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := a.Apply(ctx, testPolicySet())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "replication incomplete: dc3: replication disabled, dc4: ")
+	assert.Len(t, result.Created, 3)
+	assert.False(t, result.Synced())
+
+	require.Len(t, result.Datacenters, 3)
+	assert.True(t, result.Datacenters[0].Synced)
+	assert.False(t, result.Datacenters[1].Synced)
+	assert.EqualError(t, result.Datacenters[1].Err, "replication disabled")
+	assert.EqualValues(t, result.Index, result.Datacenters[1].Lag)
+	assert.False(t, result.Datacenters[2].Synced)
+	assert.Error(t, result.Datacenters[2].Err)
+}
+
+func TestMultiDCApplier_ApplyDuplicateName(t *testing.T) {
+	server := newTestServer(
+		&api.ACLEntry{ID: "1", Name: "web", Rules: `service "web" { policy = "read" }`},
+		&api.ACLEntry{ID: "2", Name: "web", Rules: `service "web" { policy = "write" }`},
+	)
+	defer server.Close()
+	a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1")
+
+	result, err := a.Apply(context.Background(), testPolicySet())
+	assert.EqualError(t, err, `duplicate policy name "web"`)
+	assert.Nil(t, result)
+	assert.Len(t, server.Tokens(), 2)
+
+	t.Run("Unmanaged", func(t *testing.T) {
+		server := newTestServer(
+			&api.ACLEntry{ID: "1", Rules: `key "" { policy = "read" }`},
+			&api.ACLEntry{ID: "2", Rules: `key "" { policy = "write" }`},
+			&api.ACLEntry{ID: "3", Name: "legacy", Rules: `node "" { policy = "read" }`},
+			&api.ACLEntry{ID: "4", Name: "legacy", Rules: `node "" { policy = "write" }`},
+		)
+		defer server.Close()
+		a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1")
+
+		result, err := a.Apply(context.Background(), testPolicySet())
+		require.NoError(t, err)
+		assert.Len(t, result.Created, 3)
+		assert.Len(t, server.Tokens(), 7)
+	})
+}
+
+func TestMultiDCApplier_ApplyConstraints(t *testing.T) {
+	server := newTestServer(&api.ACLEntry{ID: "1", Name: "web", Rules: `service "web" { policy = "read" }`})
+	defer server.Close()
+	a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1")
+	a.Constraints = consulacl.Constraints{
+		&consulacl.Constraint{Name: "service-read", Resource: consulacl.ResourceService, MaxGrant: consulacl.GrantRead},
+	}
+
+	result, err := a.Apply(context.Background(), testPolicySet())
+	require.Error(t, err)
+	assert.Nil(t, result)
+	constraintErr, ok := err.(*consulacl.ConstraintError)
+	require.True(t, ok, err.Error())
+	require.Len(t, constraintErr.Violations, 2)
+	assert.EqualValues(t, "db", constraintErr.Violations[0].Policy)
+	assert.EqualValues(t, "web", constraintErr.Violations[1].Policy)
+
+	// Nothing has been written
+	assert.Len(t, server.Tokens(), 1)
+	assert.EqualValues(t, `service "web" { policy = "read" }`, server.Token("1").Rules)
+}
+
+func TestMultiDCApplier_WaitReplication(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.AddDatacenter("dc2", 1)
+	a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1", "dc2")
+	a.PollInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// The index is never reached, as replication stops at the index of the authoritative datacenter
+	index := server.Index() + 10
+	statuses := a.WaitReplication(ctx, index)
+	require.Len(t, statuses, 1)
+	assert.False(t, statuses[0].Synced)
+	assert.EqualValues(t, index-statuses[0].ReplicatedIndex, statuses[0].Lag)
+	assert.Error(t, statuses[0].Err)
+	assert.True(t, statuses[0].Duration > 0)
+
+	t.Run("Disabled", func(t *testing.T) {
+		server.AddDatacenter("dc3", 0)
+		a := consulacl.NewMultiDCApplier(server.Client().ACL(), "dc1", "dc3")
+		a.PollInterval = time.Hour
+
+		// Disabled replication never recovers, so there is no need to wait for the context
+		statuses := a.WaitReplication(context.Background(), server.Index())
+		require.Len(t, statuses, 1)
+		assert.False(t, statuses[0].Synced)
+		assert.EqualError(t, statuses[0].Err, "replication disabled")
+	})
+
+	t.Run("MaxWait", func(t *testing.T) {
+		a.MaxWait = 20 * time.Millisecond
+		statuses := a.WaitReplication(context.Background(), index)
+		require.Len(t, statuses, 1)
+		assert.False(t, statuses[0].Synced)
+		assert.EqualError(t, statuses[0].Err, context.DeadlineExceeded.Error())
+	})
+}
@@ -0,0 +1,141 @@
+package consulacl
+
+// BaseLayerName is the provenance reported for rules originating from the base policy
+const BaseLayerName = "base"
+
+type overlayChange struct {
+	resource Resource
+	target   string
+	grant    Grant
+}
+
+// Overlay defines an ordered list of changes which are applied on top of a base policy
+type Overlay struct {
+	// Name identifies the overlay in the provenance of resolved rules
+	Name string
+	// Datacenter restricts the overlay to a single datacenter. An empty datacenter matches all datacenters.
+	Datacenter string
+	// Environment restricts the overlay to a single environment. An empty environment matches all environments.
+	Environment string
+
+	changes []overlayChange
+}
+
+// NewOverlay constructs a new overlay
+func NewOverlay(name string) *Overlay {
+	return &Overlay{
+		Name: name,
+	}
+}
+
+// Set adds or overrides the grant for a target of the given resource
+//
+// For global resources (keyring and operator) the target is ignored. Setting GrantNone removes the target.
+// Invalid resources are ignored.
+func (o *Overlay) Set(resource Resource, target string, grant Grant) {
+	if resource == ResourceNone || resource >= resourceMax {
+		return
+	}
+	if resource.IsGlobal() {
+		target = ""
+	}
+	o.changes = append(o.changes, overlayChange{
+		resource: resource,
+		target:   target,
+		grant:    grant,
+	})
+}
+
+// Remove removes the grant for a target of the given resource
+func (o *Overlay) Remove(resource Resource, target string) {
+	o.Set(resource, target, GrantNone)
+}
+
+// SetKeyring configures the keyring grant
+func (o *Overlay) SetKeyring(grant Grant) {
+	o.Set(ResourceKeyring, "", grant)
+}
+
+// SetOperator configures the operator grant
+func (o *Overlay) SetOperator(grant Grant) {
+	o.Set(ResourceOperator, "", grant)
+}
+
+// Applies checks if the overlay applies to the given datacenter and environment
+func (o *Overlay) Applies(datacenter, environment string) bool {
+	return (o.Datacenter == "" || o.Datacenter == datacenter) &&
+		(o.Environment == "" || o.Environment == environment)
+}
+
+// ResolvedPolicy holds a policy resolved from a base policy and overlays
+type ResolvedPolicy struct {
+	// Policy is the resolved policy
+	Policy *Policy
+
+	provenance map[Resource]map[string]string
+}
+
+// Provenance returns the name of the layer which set the grant for a target of the given resource
+//
+// BaseLayerName is returned for grants originating from the base policy. An empty string is returned
+// if the resolved policy holds no grant for the target. For global resources the target is ignored.
+func (r *ResolvedPolicy) Provenance(resource Resource, target string) string {
+	if resource.IsGlobal() {
+		target = ""
+	}
+	return r.provenance[resource][target]
+}
+
+func (r *ResolvedPolicy) setProvenance(resource Resource, target, layer string) {
+	targets, exists := r.provenance[resource]
+	if !exists {
+		targets = make(map[string]string)
+		r.provenance[resource] = targets
+	}
+	if layer == "" {
+		delete(targets, target)
+		return
+	}
+	targets[target] = layer
+}
+
+// Resolve applies all overlays which apply to the given datacenter and environment on top of the base policy
+//
+// Overlays are applied in order, so later overlays override earlier ones. The base policy is not modified.
+func Resolve(base *Policy, overlays []*Overlay, datacenter, environment string) *ResolvedPolicy {
+	r := &ResolvedPolicy{
+		Policy:     base.Clone(),
+		provenance: make(map[Resource]map[string]string),
+	}
+
+	Walk(r.Policy, VisitorFunc(func(rule Rule) {
+		r.setProvenance(rule.Resource, rule.Target, BaseLayerName)
+	}))
+
+	for _, overlay := range overlays {
+		if !overlay.Applies(datacenter, environment) {
+			continue
+		}
+
+		for _, change := range overlay.changes {
+			r.Policy.SetGrant(change.resource, change.target, change.grant)
+
+			layer := overlay.Name
+			if change.grant == GrantNone {
+				layer = ""
+			}
+			r.setProvenance(change.resource, change.target, layer)
+		}
+	}
+
+	return r
+}
+
+// ResolveDatacenters resolves the policy for each of the given datacenters, see Resolve
+func ResolveDatacenters(base *Policy, overlays []*Overlay, environment string, datacenters ...string) map[string]*ResolvedPolicy {
+	resolved := make(map[string]*ResolvedPolicy, len(datacenters))
+	for _, datacenter := range datacenters {
+		resolved[datacenter] = Resolve(base, overlays, datacenter, environment)
+	}
+	return resolved
+}
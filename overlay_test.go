@@ -0,0 +1,110 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOverlay(t *testing.T) {
+	o := NewOverlay("test")
+	require.NotNil(t, o)
+	assert.EqualValues(t, "test", o.Name)
+	assert.Empty(t, o.changes)
+}
+
+func TestOverlay_Set(t *testing.T) {
+	o := NewOverlay("test")
+	o.Set(ResourceKey, "key0", GrantWrite)
+	o.Set(ResourceOperator, "ignored", GrantRead)
+	o.Set(ResourceNone, "key0", GrantWrite)
+	o.Remove(ResourceService, "service0")
+	o.SetKeyring(GrantDeny)
+	o.SetOperator(GrantWrite)
+
+	assert.EqualValues(t, []overlayChange{
+		{ResourceKey, "key0", GrantWrite},
+		{ResourceOperator, "", GrantRead},
+		{ResourceService, "service0", GrantNone},
+		{ResourceKeyring, "", GrantDeny},
+		{ResourceOperator, "", GrantWrite},
+	}, o.changes)
+}
+
+func TestOverlay_Applies(t *testing.T) {
+	o := NewOverlay("test")
+	assert.True(t, o.Applies("dc1", "prod"))
+
+	o.Datacenter = "dc1"
+	assert.True(t, o.Applies("dc1", "prod"))
+	assert.False(t, o.Applies("dc2", "prod"))
+
+	o.Environment = "prod"
+	assert.True(t, o.Applies("dc1", "prod"))
+	assert.False(t, o.Applies("dc1", "staging"))
+}
+
+func TestResolve(t *testing.T) {
+	base := NewPolicy()
+	base.SetOperator(GrantRead)
+	base.Key().Set("app/", GrantRead)
+	base.Service().Set("web", GrantWrite)
+	base.Service().Set("legacy", GrantWrite)
+
+	prod := NewOverlay("prod")
+	prod.Environment = "prod"
+	prod.Remove(ResourceService, "legacy")
+	prod.SetKeyring(GrantRead)
+
+	dc1 := NewOverlay("dc1")
+	dc1.Datacenter = "dc1"
+	dc1.Set(ResourceKey, "app/", GrantWrite)
+	dc1.Set(ResourceKey, "dc1/", GrantRead)
+	dc1.SetOperator(GrantNone)
+
+	overlays := []*Overlay{prod, dc1}
+
+	t.Run("Layered", func(t *testing.T) {
+		r := Resolve(base, overlays, "dc1", "prod")
+		require.NotNil(t, r.Policy)
+
+		assert.EqualValues(t, GrantRead, r.Policy.GetKeyring())
+		assert.EqualValues(t, "prod", r.Provenance(ResourceKeyring, "ignored"))
+		assert.EqualValues(t, GrantNone, r.Policy.GetOperator())
+		assert.EqualValues(t, "", r.Provenance(ResourceOperator, ""))
+
+		assert.EqualValues(t, GrantWrite, r.Policy.Key().Get("app/"))
+		assert.EqualValues(t, "dc1", r.Provenance(ResourceKey, "app/"))
+		assert.EqualValues(t, GrantRead, r.Policy.Key().Get("dc1/"))
+		assert.EqualValues(t, "dc1", r.Provenance(ResourceKey, "dc1/"))
+
+		assert.EqualValues(t, GrantWrite, r.Policy.Service().Get("web"))
+		assert.EqualValues(t, BaseLayerName, r.Provenance(ResourceService, "web"))
+		assert.EqualValues(t, GrantNone, r.Policy.Service().Get("legacy"))
+		assert.EqualValues(t, "", r.Provenance(ResourceService, "legacy"))
+	})
+
+	t.Run("BaseOnly", func(t *testing.T) {
+		r := Resolve(base, overlays, "dc2", "staging")
+		assert.True(t, r.Policy.Equals(base))
+		assert.EqualValues(t, BaseLayerName, r.Provenance(ResourceOperator, ""))
+		assert.EqualValues(t, BaseLayerName, r.Provenance(ResourceKey, "app/"))
+		assert.EqualValues(t, "", r.Provenance(ResourceKeyring, ""))
+	})
+
+	t.Run("BaseUnmodified", func(t *testing.T) {
+		Resolve(base, overlays, "dc1", "prod")
+		assert.EqualValues(t, GrantRead, base.GetOperator())
+		assert.EqualValues(t, GrantRead, base.Key().Get("app/"))
+		assert.EqualValues(t, GrantWrite, base.Service().Get("legacy"))
+	})
+
+	t.Run("Datacenters", func(t *testing.T) {
+		resolved := ResolveDatacenters(base, overlays, "prod", "dc1", "dc2")
+		require.Len(t, resolved, 2)
+		assert.EqualValues(t, GrantWrite, resolved["dc1"].Policy.Key().Get("app/"))
+		assert.EqualValues(t, GrantRead, resolved["dc2"].Policy.Key().Get("app/"))
+		assert.EqualValues(t, GrantRead, resolved["dc2"].Policy.GetKeyring())
+	})
+}
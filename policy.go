@@ -1,6 +1,8 @@
 package consulacl
 
 import (
+	"sync"
+
 	"github.com/hashicorp/consul/acl"
 )
 
@@ -14,44 +16,107 @@ type Policy struct {
 	event   GrantMap
 	query   GrantMap
 
+	// mu guards the keyring and operator grants as well as the observers
+	mu       sync.RWMutex
 	keyring  Grant
 	operator Grant
+
+	observers      []policyObserver
+	nextObserverID uint64
 }
 
 // Equals checks if the policy matches another policy
 func (p *Policy) Equals(other *Policy) bool {
-	return other != nil &&
-		p.keyring == other.keyring &&
-		p.operator == other.operator &&
-		p.agent.Equals(&other.agent) &&
-		p.key.Equals(&other.key) &&
-		p.node.Equals(&other.node) &&
-		p.service.Equals(&other.service) &&
-		p.session.Equals(&other.session) &&
-		p.event.Equals(&other.event) &&
-		p.query.Equals(&other.query)
+	if other == nil {
+		return false
+	}
+
+	// Compare snapshots, so the locks of both policies are never held at the same time
+	a, b := p.Clone(), other.Clone()
+	return a.keyring == b.keyring &&
+		a.operator == b.operator &&
+		a.agent.Equals(&b.agent) &&
+		a.key.Equals(&b.key) &&
+		a.node.Equals(&b.node) &&
+		a.service.Equals(&b.service) &&
+		a.session.Equals(&b.session) &&
+		a.event.Equals(&b.event) &&
+		a.query.Equals(&b.query)
 }
 
 // SetKeyring configures the keyring grant
 func (p *Policy) SetKeyring(grant Grant) {
+	p.mu.Lock()
+	old := p.keyring
 	p.keyring = grant
+	observers := p.observers
+	p.mu.Unlock()
+
+	if old != grant {
+		notifyPolicyObservers(observers, Change{Type: ChangeKeyring, Resource: ResourceKeyring, Old: old, New: grant})
+	}
 }
 
 // GetKeyring retrieves the keyring grant
 func (p *Policy) GetKeyring() Grant {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.keyring
 }
 
 // SetOperator configures the operator grant
 func (p *Policy) SetOperator(grant Grant) {
+	p.mu.Lock()
+	old := p.operator
 	p.operator = grant
+	observers := p.observers
+	p.mu.Unlock()
+
+	if old != grant {
+		notifyPolicyObservers(observers, Change{Type: ChangeOperator, Resource: ResourceOperator, Old: old, New: grant})
+	}
 }
 
 // GetOperator retrieves the operator grant
 func (p *Policy) GetOperator() Grant {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.operator
 }
 
+// SetGrant configures the grant for a target of the given resource
+//
+// For global resources (keyring and operator) the target is ignored. Invalid resources are ignored.
+func (p *Policy) SetGrant(resource Resource, target string, grant Grant) {
+	switch resource {
+	case ResourceKeyring:
+		p.SetKeyring(grant)
+	case ResourceOperator:
+		p.SetOperator(grant)
+	default:
+		if gm := p.grantMap(resource); gm != nil {
+			gm.Set(target, grant)
+		}
+	}
+}
+
+// GetGrant retrieves the grant for a target of the given resource
+//
+// For global resources (keyring and operator) the target is ignored. GrantNone is returned for
+// invalid resources.
+func (p *Policy) GetGrant(resource Resource, target string) Grant {
+	switch resource {
+	case ResourceKeyring:
+		return p.GetKeyring()
+	case ResourceOperator:
+		return p.GetOperator()
+	}
+	if gm := p.grantMap(resource); gm != nil {
+		return gm.Get(target)
+	}
+	return GrantNone
+}
+
 // Agent returns the agent GrantMap
 func (p *Policy) Agent() *GrantMap {
 	return &p.agent
@@ -88,7 +153,25 @@ func (p *Policy) Query() *GrantMap {
 }
 
 // Clone creates a copy of the policy
+//
+// The copy is a consistent snapshot with regard to updates applied using Update.
 func (p *Policy) Clone() *Policy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Lock all embedded GrantMap instances in the same order as Update does
+	for _, resource := range TargetResources {
+		gm := p.grantMap(resource)
+		gm.mu.RLock()
+		defer gm.mu.RUnlock()
+	}
+
+	return p.cloneLocked()
+}
+
+// cloneLocked creates a copy of the policy. The caller has to hold the locks of the policy and all
+// embedded GrantMap instances.
+func (p *Policy) cloneLocked() *Policy {
 	// Create a new policy and apply the basic keyring and operator grants
 	clone := &Policy{
 		keyring:  p.keyring,
@@ -96,17 +179,38 @@ func (p *Policy) Clone() *Policy {
 	}
 
 	// Create clones of all embedded GrantMap instances
-	clone.agent = *p.agent.Clone()
-	clone.key = *p.key.Clone()
-	clone.node = *p.node.Clone()
-	clone.service = *p.service.Clone()
-	clone.session = *p.session.Clone()
-	clone.event = *p.event.Clone()
-	clone.query = *p.query.Clone()
+	clone.agent = *p.agent.cloneLocked()
+	clone.key = *p.key.cloneLocked()
+	clone.node = *p.node.cloneLocked()
+	clone.service = *p.service.cloneLocked()
+	clone.session = *p.session.cloneLocked()
+	clone.event = *p.event.cloneLocked()
+	clone.query = *p.query.cloneLocked()
 
 	return clone
 }
 
+// Merge applies all grants of the other policy on top of the policy
+//
+// Grants of the other policy override existing grants for the same target. Keyring and operator
+// grants are only overridden if they are set in the other policy.
+func (p *Policy) Merge(other *Policy) {
+	if keyring := other.GetKeyring(); keyring != GrantNone {
+		p.SetKeyring(keyring)
+	}
+	if operator := other.GetOperator(); operator != GrantNone {
+		p.SetOperator(operator)
+	}
+
+	p.agent.merge(&other.agent)
+	p.key.merge(&other.key)
+	p.node.merge(&other.node)
+	p.service.merge(&other.service)
+	p.session.merge(&other.session)
+	p.event.merge(&other.event)
+	p.query.merge(&other.query)
+}
+
 // NewPolicy constructs a new policy
 func NewPolicy() *Policy {
 	return &Policy{}
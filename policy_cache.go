@@ -0,0 +1,120 @@
+package consulacl
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/golang-lru"
+)
+
+// CacheStats holds the statistics of a PolicyCache
+type CacheStats struct {
+	// Hits is the number of lookups answered from the cache
+	Hits uint64
+	// Misses is the number of lookups which required parsing the rules
+	Misses uint64
+	// Entries is the number of cached policies
+	Entries int
+}
+
+type policyCacheEntry struct {
+	policy   *Policy
+	compiled *CompiledPolicy
+}
+
+// PolicyCache is a bounded cache of parsed and compiled policies keyed by the ID of their rules
+//
+// The least recently used policy is evicted once the cache is full. Rules are identified by their ID
+// as computed by acl.RuleID. Rules which fail to parse are not cached. A PolicyCache is safe for
+// concurrent use.
+type PolicyCache struct {
+	// hits and misses are accessed atomically and have to be 64-bit aligned
+	hits   uint64
+	misses uint64
+
+	cache *lru.Cache
+}
+
+// NewPolicyCache constructs a new policy cache holding up to size policies
+func NewPolicyCache(size int) (*PolicyCache, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid cache size: %d", size)
+	}
+
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PolicyCache{
+		cache: cache,
+	}, nil
+}
+
+func (c *PolicyCache) get(rules string) (*policyCacheEntry, error) {
+	id := acl.RuleID(rules)
+	if raw, ok := c.cache.Get(id); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return raw.(*policyCacheEntry), nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	p, err := NewPolicyFromRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &policyCacheEntry{
+		policy:   p,
+		compiled: p.Compile(),
+	}
+	c.cache.Add(id, entry)
+	return entry, nil
+}
+
+// Policy retrieves the policy represented by the rules, parsing them if they are not cached
+//
+// A copy of the cached policy is returned, so the caller may modify it.
+func (c *PolicyCache) Policy(rules string) (*Policy, error) {
+	entry, err := c.get(rules)
+	if err != nil {
+		return nil, err
+	}
+	return entry.policy.Clone(), nil
+}
+
+// Compiled retrieves the compiled policy represented by the rules, parsing them if they are not cached
+func (c *PolicyCache) Compiled(rules string) (*CompiledPolicy, error) {
+	entry, err := c.get(rules)
+	if err != nil {
+		return nil, err
+	}
+	return entry.compiled, nil
+}
+
+// Invalidate removes the policy represented by the rules from the cache
+func (c *PolicyCache) Invalidate(rules string) {
+	c.InvalidateID(acl.RuleID(rules))
+}
+
+// InvalidateID removes the policy with the given rule ID from the cache
+func (c *PolicyCache) InvalidateID(id string) {
+	c.cache.Remove(id)
+}
+
+// Purge removes all policies from the cache
+//
+// The statistics are not reset.
+func (c *PolicyCache) Purge() {
+	c.cache.Purge()
+}
+
+// Stats returns the current statistics of the cache
+func (c *PolicyCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: c.cache.Len(),
+	}
+}
@@ -0,0 +1,132 @@
+package consulacl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicyCache(t *testing.T) {
+	t.Run("InvalidSize", func(t *testing.T) {
+		c, err := NewPolicyCache(0)
+		assert.EqualError(t, err, "invalid cache size: 0")
+		assert.Nil(t, c)
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		c, err := NewPolicyCache(16)
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		assert.EqualValues(t, CacheStats{}, c.Stats())
+	})
+}
+
+func TestPolicyCache_Policy(t *testing.T) {
+	c, err := NewPolicyCache(16)
+	require.NoError(t, err)
+
+	rules := `key "app/" { policy = "write" }`
+
+	p, err := c.Policy(rules)
+	require.NoError(t, err)
+	assert.EqualValues(t, GrantWrite, p.Key().Get("app/"))
+	assert.EqualValues(t, CacheStats{Misses: 1, Entries: 1}, c.Stats())
+
+	// Modifying the returned policy must not affect the cache
+	p.Key().Set("app/", GrantDeny)
+
+	p, err = c.Policy(rules)
+	require.NoError(t, err)
+	assert.EqualValues(t, GrantWrite, p.Key().Get("app/"))
+	assert.EqualValues(t, CacheStats{Hits: 1, Misses: 1, Entries: 1}, c.Stats())
+
+	t.Run("ParseError", func(t *testing.T) {
+		p, err := c.Policy(`agent = "read"`)
+		assert.Error(t, err)
+		assert.Nil(t, p)
+		assert.EqualValues(t, CacheStats{Hits: 1, Misses: 2, Entries: 1}, c.Stats())
+	})
+}
+
+func TestPolicyCache_Compiled(t *testing.T) {
+	c, err := NewPolicyCache(16)
+	require.NoError(t, err)
+
+	rules := `service "web" { policy = "read" }`
+
+	compiled, err := c.Compiled(rules)
+	require.NoError(t, err)
+	assert.True(t, compiled.Allows(ResourceService, "web", AccessRead))
+
+	other, err := c.Compiled(rules)
+	require.NoError(t, err)
+	assert.True(t, compiled == other)
+	assert.EqualValues(t, CacheStats{Hits: 1, Misses: 1, Entries: 1}, c.Stats())
+
+	compiled, err = c.Compiled(`agent = "read"`)
+	assert.Error(t, err)
+	assert.Nil(t, compiled)
+}
+
+func TestPolicyCache_Invalidate(t *testing.T) {
+	c, err := NewPolicyCache(16)
+	require.NoError(t, err)
+
+	rules0 := `key "test0" { policy = "read" }`
+	rules1 := `key "test1" { policy = "read" }`
+	_, err = c.Policy(rules0)
+	require.NoError(t, err)
+	_, err = c.Policy(rules1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, c.Stats().Entries)
+
+	c.Invalidate(rules0)
+	assert.EqualValues(t, 1, c.Stats().Entries)
+
+	c.InvalidateID(acl.RuleID(rules1))
+	assert.EqualValues(t, 0, c.Stats().Entries)
+
+	_, err = c.Policy(rules0)
+	require.NoError(t, err)
+	assert.EqualValues(t, CacheStats{Misses: 3, Entries: 1}, c.Stats())
+
+	c.Purge()
+	assert.EqualValues(t, CacheStats{Misses: 3}, c.Stats())
+}
+
+func TestPolicyCache_Bounded(t *testing.T) {
+	c, err := NewPolicyCache(4)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err := c.Policy(fmt.Sprintf(`key "test%d" { policy = "read" }`, i))
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 4, c.Stats().Entries)
+}
+
+func TestPolicyCache_LeastRecentlyUsed(t *testing.T) {
+	c, err := NewPolicyCache(2)
+	require.NoError(t, err)
+
+	rules := func(i int) string {
+		return fmt.Sprintf(`key "test%d" { policy = "read" }`, i)
+	}
+
+	for _, i := range []int{0, 1, 0, 2} {
+		_, err := c.Policy(rules(i))
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, CacheStats{Hits: 1, Misses: 3, Entries: 2}, c.Stats())
+
+	// The recently used rules0 is kept while rules1 has been evicted
+	_, err = c.Policy(rules(0))
+	require.NoError(t, err)
+	assert.EqualValues(t, CacheStats{Hits: 2, Misses: 3, Entries: 2}, c.Stats())
+	_, err = c.Policy(rules(1))
+	require.NoError(t, err)
+	assert.EqualValues(t, CacheStats{Hits: 2, Misses: 4, Entries: 2}, c.Stats())
+}
@@ -0,0 +1,69 @@
+package consulacl
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RuleChange describes the difference of a single rule between two policies
+type RuleChange struct {
+	Resource Resource
+	// Target is the changed target. It is empty for global resources (keyring and operator).
+	Target string
+	// Old is the grant in the old policy, GrantNone if the rule was added
+	Old Grant
+	// New is the grant in the new policy, GrantNone if the rule was removed
+	New Grant
+}
+
+// String returns the string representation of a rule change, e.g. `~ key "app/" = "read" -> "write"`
+func (c RuleChange) String() string {
+	switch {
+	case c.Old == GrantNone:
+		return "+ " + Rule{Resource: c.Resource, Target: c.Target, Grant: c.New}.String()
+	case c.New == GrantNone:
+		return "- " + Rule{Resource: c.Resource, Target: c.Target, Grant: c.Old}.String()
+	}
+	return fmt.Sprintf(`~ %s -> "%s"`, Rule{Resource: c.Resource, Target: c.Target, Grant: c.Old}.String(), c.New.String())
+}
+
+// Diff returns the rules which differ between the policies from and to
+//
+// A nil policy is treated like an empty policy. Changes are sorted by resource and target.
+func Diff(from, to *Policy) []RuleChange {
+	if from == nil {
+		from = NewPolicy()
+	}
+	if to == nil {
+		to = NewPolicy()
+	}
+
+	keys := make(map[ruleKey]bool)
+	collect := VisitorFunc(func(rule Rule) {
+		keys[ruleKey{rule.Resource, rule.Target}] = true
+	})
+	Walk(from, collect)
+	Walk(to, collect)
+
+	var changes []RuleChange
+	for key := range keys {
+		o := from.GetGrant(key.resource, key.target)
+		n := to.GetGrant(key.resource, key.target)
+		if o != n {
+			changes = append(changes, RuleChange{
+				Resource: key.resource,
+				Target:   key.target,
+				Old:      o,
+				New:      n,
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Resource != changes[j].Resource {
+			return changes[i].Resource < changes[j].Resource
+		}
+		return changes[i].Target < changes[j].Target
+	})
+
+	return changes
+}
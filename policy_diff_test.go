@@ -0,0 +1,46 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleChange_String(t *testing.T) {
+	assert.EqualValues(t, `+ key "app/" = "read"`, RuleChange{Resource: ResourceKey, Target: "app/", New: GrantRead}.String())
+	assert.EqualValues(t, `- service "web" = "write"`, RuleChange{Resource: ResourceService, Target: "web", Old: GrantWrite}.String())
+	assert.EqualValues(t, `~ operator = "read" -> "write"`, RuleChange{Resource: ResourceOperator, Old: GrantRead, New: GrantWrite}.String())
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		assert.Empty(t, Diff(nil, nil))
+
+		p := NewPolicy()
+		p.SetKeyring(GrantRead)
+		assert.EqualValues(t, []RuleChange{{Resource: ResourceKeyring, New: GrantRead}}, Diff(nil, p))
+		assert.EqualValues(t, []RuleChange{{Resource: ResourceKeyring, Old: GrantRead}}, Diff(p, nil))
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		from := NewPolicy()
+		from.SetOperator(GrantRead)
+		from.Key().Set("app/", GrantRead)
+		from.Key().Set("shared/", GrantRead)
+		from.Service().Set("web", GrantWrite)
+
+		to := from.Clone()
+		to.SetOperator(GrantWrite)
+		to.Key().Set("app/", GrantWrite)
+		to.Key().Set("other/", GrantDeny)
+		to.Service().Remove("web")
+
+		assert.EqualValues(t, []RuleChange{
+			{Resource: ResourceKey, Target: "app/", Old: GrantRead, New: GrantWrite},
+			{Resource: ResourceKey, Target: "other/", New: GrantDeny},
+			{Resource: ResourceService, Target: "web", Old: GrantWrite},
+			{Resource: ResourceOperator, Old: GrantRead, New: GrantWrite},
+		}, Diff(from, to))
+		assert.Empty(t, Diff(from, from))
+	})
+}
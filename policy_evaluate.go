@@ -0,0 +1,106 @@
+package consulacl
+
+// Decision holds the result of evaluating an access request against a policy
+type Decision struct {
+	// Resource is the resource kind the request applies to
+	Resource Resource
+	// Target is the requested target, e.g. the key or service name
+	Target string
+	// Access is the requested access
+	Access Access
+	// Allowed defines if the request is allowed
+	Allowed bool
+	// Matched defines if a rule matched the request. If no rule matched the request is denied by default.
+	Matched bool
+	// Prefix is the target of the matching rule
+	Prefix string
+	// Grant is the grant of the matching rule
+	Grant Grant
+}
+
+// Rule returns a string representation of the rule that decided the request
+func (d Decision) Rule() string {
+	if !d.Matched {
+		return "<default deny>"
+	}
+	return Rule{Resource: d.Resource, Target: d.Prefix, Grant: d.Grant}.String()
+}
+
+// grantMap returns the GrantMap responsible for the given resource
+//
+// nil is returned for global and invalid resources
+func (p *Policy) grantMap(resource Resource) *GrantMap {
+	switch resource {
+	case ResourceAgent:
+		return &p.agent
+	case ResourceKey:
+		return &p.key
+	case ResourceNode:
+		return &p.node
+	case ResourceService:
+		return &p.service
+	case ResourceSession:
+		return &p.session
+	case ResourceEvent:
+		return &p.event
+	case ResourceQuery:
+		return &p.query
+	}
+	return nil
+}
+
+// Evaluate decides whether the policy allows the given access to a target of a resource
+//
+// Rules are matched the same way consul does: the rule with the longest matching prefix wins.
+// Requests which are not matched by any rule are denied. For global resources (keyring and
+// operator) the target is ignored.
+func (p *Policy) Evaluate(resource Resource, target string, access Access) Decision {
+	d := Decision{
+		Resource: resource,
+		Target:   target,
+		Access:   access,
+	}
+
+	switch resource {
+	case ResourceKeyring:
+		d.Grant = p.GetKeyring()
+		d.Matched = d.Grant != GrantNone
+	case ResourceOperator:
+		d.Grant = p.GetOperator()
+		d.Matched = d.Grant != GrantNone
+	default:
+		if gm := p.grantMap(resource); gm != nil {
+			d.Prefix, d.Grant, d.Matched = gm.LongestPrefix(target)
+		}
+	}
+
+	return d.decide()
+}
+
+// Allows checks if the policy allows the given access to a target of a resource
+func (p *Policy) Allows(resource Resource, target string, access Access) bool {
+	return p.Evaluate(resource, target, access).Allowed
+}
+
+// decide sets Allowed based on the matching rule of the decision
+func (d Decision) decide() Decision {
+	d.Allowed = d.Matched && grantAllows(d.Resource, d.Grant, d.Access)
+	return d
+}
+
+// grantAllows checks if a grant on the given resource allows the requested access
+func grantAllows(resource Resource, grant Grant, access Access) bool {
+	switch access {
+	case AccessWrite:
+		return grant == GrantWrite
+	case AccessRead:
+		return grant == GrantRead || grant == GrantWrite || (resource == ResourceKey && grant == GrantList)
+	case AccessList:
+		if resource == ResourceKey {
+			return grant == GrantList || grant == GrantWrite
+		}
+		// Listing is only distinct from reading for keys
+		return grant == GrantRead || grant == GrantWrite
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecision_Rule(t *testing.T) {
+	assert.EqualValues(t, "<default deny>", Decision{}.Rule())
+	assert.EqualValues(t, `operator = "read"`, Decision{
+		Resource: ResourceOperator,
+		Matched:  true,
+		Grant:    GrantRead,
+	}.Rule())
+	assert.EqualValues(t, `key "app/" = "deny"`, Decision{
+		Resource: ResourceKey,
+		Target:   "app/test",
+		Matched:  true,
+		Prefix:   "app/",
+		Grant:    GrantDeny,
+	}.Rule())
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	rules := `keyring = "read"
+operator = "deny"
+key "" {
+  policy = "read"
+}
+key "app/" {
+  policy = "write"
+}
+key "app/secret" {
+  policy = "deny"
+}
+key "list/" {
+  policy = "list"
+}
+service "" {
+  policy = "read"
+}
+service "web" {
+  policy = "write"
+}
+node "db" {
+  policy = "deny"
+}`
+
+	p, err := NewPolicyFromRules(rules)
+	require.NoError(t, err)
+
+	t.Run("Decision", func(t *testing.T) {
+		d := p.Evaluate(ResourceKey, "app/secret/db", AccessRead)
+		assert.False(t, d.Allowed)
+		assert.True(t, d.Matched)
+		assert.EqualValues(t, "app/secret", d.Prefix)
+		assert.EqualValues(t, GrantDeny, d.Grant)
+
+		d = p.Evaluate(ResourceAgent, "agent0", AccessRead)
+		assert.False(t, d.Allowed)
+		assert.False(t, d.Matched)
+
+		d = p.Evaluate(ResourceNone, "test", AccessRead)
+		assert.False(t, d.Allowed)
+		assert.False(t, d.Matched)
+	})
+
+	t.Run("MatchesConsul", func(t *testing.T) {
+		aclPolicy, err := acl.Parse(rules, nil)
+		require.NoError(t, err)
+		compiled, err := acl.New(acl.DenyAll(), aclPolicy, nil)
+		require.NoError(t, err)
+
+		for _, target := range []string{"", "app", "app/", "app/config", "app/secret", "app/secrets", "list/", "list/a", "other"} {
+			assert.EqualValues(t, compiled.KeyRead(target), p.Allows(ResourceKey, target, AccessRead), "key read %q", target)
+			assert.EqualValues(t, compiled.KeyList(target), p.Allows(ResourceKey, target, AccessList), "key list %q", target)
+			assert.EqualValues(t, compiled.KeyWrite(target, nil), p.Allows(ResourceKey, target, AccessWrite), "key write %q", target)
+		}
+
+		for _, target := range []string{"", "web", "web-frontend", "db"} {
+			assert.EqualValues(t, compiled.ServiceRead(target), p.Allows(ResourceService, target, AccessRead), "service read %q", target)
+			assert.EqualValues(t, compiled.ServiceWrite(target, nil), p.Allows(ResourceService, target, AccessWrite), "service write %q", target)
+			assert.EqualValues(t, compiled.NodeRead(target), p.Allows(ResourceNode, target, AccessRead), "node read %q", target)
+			assert.EqualValues(t, compiled.NodeWrite(target, nil), p.Allows(ResourceNode, target, AccessWrite), "node write %q", target)
+		}
+
+		assert.EqualValues(t, compiled.KeyringRead(), p.Allows(ResourceKeyring, "", AccessRead))
+		assert.EqualValues(t, compiled.KeyringWrite(), p.Allows(ResourceKeyring, "", AccessWrite))
+		assert.EqualValues(t, compiled.OperatorRead(), p.Allows(ResourceOperator, "", AccessRead))
+		assert.EqualValues(t, compiled.OperatorWrite(), p.Allows(ResourceOperator, "", AccessWrite))
+	})
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	p := NewPolicy()
+	p.Service().Set("web", GrantRead)
+
+	assert.True(t, p.Allows(ResourceService, "web", AccessRead))
+	assert.True(t, p.Allows(ResourceService, "web", AccessList))
+	assert.False(t, p.Allows(ResourceService, "web", AccessWrite))
+	assert.False(t, p.Allows(ResourceService, "web", AccessNone))
+}
@@ -0,0 +1,21 @@
+package consulacl
+
+import (
+	"github.com/hashicorp/consul/acl"
+)
+
+// Fingerprint returns a stable fingerprint of the policy
+//
+// The fingerprint is computed the same way consul computes the ID of rules (see acl.RuleID), from the
+// canonical rules returned by GenerateRules. Policies holding the same rules share the same fingerprint,
+// regardless of formatting or ordering of their original rules text.
+func (p *Policy) Fingerprint() string {
+	return acl.RuleID(p.GenerateRules())
+}
+
+// SemanticFingerprint returns a fingerprint of the normalized policy
+//
+// Unlike Fingerprint, policies which differ only by redundant rules share the same fingerprint, see Normalize.
+func (p *Policy) SemanticFingerprint() string {
+	return p.Normalize().Fingerprint()
+}
@@ -0,0 +1,49 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Fingerprint(t *testing.T) {
+	p, err := NewPolicyFromRules(`key "app/" { policy = "write" }
+operator = "read"`)
+	require.NoError(t, err)
+
+	other, err := NewPolicyFromRules(`operator = "read"
+
+key "app/" {
+  policy = "write"
+}`)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, acl.RuleID(p.GenerateRules()), p.Fingerprint())
+	assert.EqualValues(t, p.Fingerprint(), other.Fingerprint())
+
+	// Canonical rules share the ID consul computes for them
+	assert.EqualValues(t, acl.RuleID(`operator = "read"
+key "app/" {
+  policy = "write"
+}`), p.Fingerprint())
+
+	other.Key().Set("app/config", GrantWrite)
+	assert.NotEqual(t, p.Fingerprint(), other.Fingerprint())
+}
+
+func TestPolicy_SemanticFingerprint(t *testing.T) {
+	p := NewPolicy()
+	p.Key().Set("app/", GrantWrite)
+
+	other := p.Clone()
+	other.Key().Set("app/config", GrantWrite)
+
+	assert.NotEqual(t, p.Fingerprint(), other.Fingerprint())
+	assert.EqualValues(t, p.SemanticFingerprint(), other.SemanticFingerprint())
+	assert.EqualValues(t, p.Fingerprint(), p.SemanticFingerprint())
+
+	other.Key().Set("app/config", GrantRead)
+	assert.NotEqual(t, p.SemanticFingerprint(), other.SemanticFingerprint())
+}
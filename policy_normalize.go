@@ -0,0 +1,32 @@
+package consulacl
+
+import (
+	"strings"
+)
+
+// Normalize creates a semantically equivalent copy of the policy without redundant rules
+//
+// A rule is redundant if the rule with the longest prefix of its target holds the same grant, as every
+// request matched by the rule would be decided the same way without it.
+func (p *Policy) Normalize() *Policy {
+	snapshot := p.Clone()
+	return Transform(snapshot, func(rule Rule) (Rule, bool) {
+		if rule.Resource.IsGlobal() {
+			return rule, true
+		}
+
+		gm := snapshot.grantMap(rule.Resource)
+		var parent string
+		parentFound := false
+		for _, candidate := range gm.Targets() {
+			if candidate == rule.Target || !strings.HasPrefix(rule.Target, candidate) {
+				continue
+			}
+			if !parentFound || len(candidate) > len(parent) {
+				parent, parentFound = candidate, true
+			}
+		}
+
+		return rule, !parentFound || gm.Get(parent) != rule.Grant
+	})
+}
@@ -0,0 +1,39 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Normalize(t *testing.T) {
+	p := NewPolicy()
+	p.SetKeyring(GrantDeny)
+	p.SetOperator(GrantRead)
+	p.Key().Set("", GrantRead)
+	p.Key().Set("app", GrantRead)
+	p.Key().Set("app/", GrantRead)
+	p.Key().Set("app/secret", GrantDeny)
+	p.Key().Set("app/secret/public", GrantRead)
+	p.Key().Set("app/secret/private", GrantDeny)
+	p.Service().Set("web", GrantWrite)
+	p.Service().Set("web-frontend", GrantWrite)
+	p.Node().Set("db", GrantDeny)
+
+	normalized := p.Normalize()
+	assert.EqualValues(t, GrantDeny, normalized.GetKeyring())
+	assert.EqualValues(t, GrantRead, normalized.GetOperator())
+	assert.EqualValues(t, []string{"", "app/secret", "app/secret/public"}, normalized.Key().Targets())
+	assert.EqualValues(t, []string{"web"}, normalized.Service().Targets())
+	assert.EqualValues(t, []string{"db"}, normalized.Node().Targets())
+
+	// Ensure the normalized policy decides all requests the same way
+	for _, target := range []string{"", "a", "app", "app/", "app/config", "app/secret", "app/secret/public/x", "app/secret/private"} {
+		for _, access := range []Access{AccessList, AccessRead, AccessWrite} {
+			assert.EqualValues(t, p.Allows(ResourceKey, target, access), normalized.Allows(ResourceKey, target, access), "%q %s", target, access.String())
+		}
+	}
+
+	// Ensure the source is unaffected
+	assert.Len(t, p.Key().Targets(), 6)
+}
@@ -0,0 +1,82 @@
+package consulacl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Matcher defines the interface of types matching rule targets
+type Matcher interface {
+	// Match checks if the target matches
+	Match(target string) bool
+}
+
+// MatcherFunc is an adapter to allow the use of ordinary functions as Matcher
+type MatcherFunc func(target string) bool
+
+// Match implements Matcher
+func (fn MatcherFunc) Match(target string) bool {
+	return fn(target)
+}
+
+// RegexpMatcher returns a Matcher which matches targets using the regular expression
+func RegexpMatcher(re *regexp.Regexp) Matcher {
+	return MatcherFunc(re.MatchString)
+}
+
+// GlobMatcher returns a Matcher which matches targets using the glob pattern
+//
+// "*" matches any sequence of characters including "/", "?" matches any single character. The pattern
+// has to match the whole target.
+func GlobMatcher(pattern string) Matcher {
+	var expr []string
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr = append(expr, ".*")
+		case '?':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+	return RegexpMatcher(regexp.MustCompile("^(?s:" + strings.Join(expr, "") + ")$"))
+}
+
+// matchesRule checks if a rule is of one of the resources and matches the matcher
+//
+// An empty list of resources matches all resources and a nil matcher matches all targets. The matcher
+// is not applied to global resources (keyring and operator).
+func matchesRule(rule Rule, resources []Resource, matcher Matcher) bool {
+	if len(resources) > 0 {
+		found := false
+		for _, resource := range resources {
+			if resource == rule.Resource {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return rule.Resource.IsGlobal() || matcher == nil || matcher.Match(rule.Target)
+}
+
+// Project creates a new policy holding only the rules of the given resources whose targets match
+//
+// An empty list of resources selects all resources and a nil matcher matches all targets. The keyring
+// and operator grants are selected by resource only.
+func (p *Policy) Project(resources []Resource, matcher Matcher) *Policy {
+	return Transform(p, func(rule Rule) (Rule, bool) {
+		return rule, matchesRule(rule, resources, matcher)
+	})
+}
+
+// Exclude creates a new policy holding all rules except those selected by Project
+func (p *Policy) Exclude(resources []Resource, matcher Matcher) *Policy {
+	return Transform(p, func(rule Rule) (Rule, bool) {
+		return rule, !matchesRule(rule, resources, matcher)
+	})
+}
@@ -0,0 +1,68 @@
+package consulacl
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobMatcher(t *testing.T) {
+	m := GlobMatcher("payments/*")
+	assert.True(t, m.Match("payments/"))
+	assert.True(t, m.Match("payments/db/creds"))
+	assert.False(t, m.Match("payments"))
+	assert.False(t, m.Match("other/payments/"))
+
+	m = GlobMatcher("web-?.example+")
+	assert.True(t, m.Match("web-1.example+"))
+	assert.False(t, m.Match("web-12.example+"))
+	assert.False(t, m.Match("web-1xexample+"))
+}
+
+func TestRegexpMatcher(t *testing.T) {
+	m := RegexpMatcher(regexp.MustCompile(`^payments(-\w+)?$`))
+	assert.True(t, m.Match("payments"))
+	assert.True(t, m.Match("payments-api"))
+	assert.False(t, m.Match("payments/"))
+}
+
+func TestPolicy_Project(t *testing.T) {
+	p := NewPolicy()
+	p.SetOperator(GrantRead)
+	p.Key().Set("payments/", GrantWrite)
+	p.Key().Set("shipping/", GrantWrite)
+	p.Service().Set("payments/api", GrantWrite)
+	p.Service().Set("shipping/api", GrantWrite)
+	p.Node().Set("payments/node", GrantRead)
+
+	t.Run("Project", func(t *testing.T) {
+		projected := p.Project([]Resource{ResourceKey, ResourceService}, GlobMatcher("payments/*"))
+		assert.EqualValues(t, GrantNone, projected.GetOperator())
+		assert.EqualValues(t, []string{"payments/"}, projected.Key().Targets())
+		assert.EqualValues(t, []string{"payments/api"}, projected.Service().Targets())
+		assert.Empty(t, projected.Node().Targets())
+	})
+
+	t.Run("AllResources", func(t *testing.T) {
+		projected := p.Project(nil, GlobMatcher("payments/*"))
+		assert.EqualValues(t, GrantRead, projected.GetOperator())
+		assert.EqualValues(t, []string{"payments/"}, projected.Key().Targets())
+		assert.EqualValues(t, []string{"payments/node"}, projected.Node().Targets())
+	})
+
+	t.Run("AllTargets", func(t *testing.T) {
+		projected := p.Project([]Resource{ResourceKey, ResourceOperator}, nil)
+		assert.EqualValues(t, GrantRead, projected.GetOperator())
+		assert.EqualValues(t, []string{"payments/", "shipping/"}, projected.Key().Targets())
+		assert.Empty(t, projected.Service().Targets())
+	})
+
+	t.Run("Exclude", func(t *testing.T) {
+		excluded := p.Exclude([]Resource{ResourceKey, ResourceService}, GlobMatcher("payments/*"))
+		assert.EqualValues(t, GrantRead, excluded.GetOperator())
+		assert.EqualValues(t, []string{"shipping/"}, excluded.Key().Targets())
+		assert.EqualValues(t, []string{"shipping/api"}, excluded.Service().Targets())
+		assert.EqualValues(t, []string{"payments/node"}, excluded.Node().Targets())
+	})
+}
@@ -0,0 +1,190 @@
+package consulacl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rewriter defines the interface of types which rewrite rule targets
+type Rewriter interface {
+	// Rewrite returns the new target for the given target
+	Rewrite(target string) (string, error)
+}
+
+// RewriterFunc is an adapter to allow the use of ordinary functions as Rewriter
+type RewriterFunc func(target string) (string, error)
+
+// Rewrite implements Rewriter
+func (fn RewriterFunc) Rewrite(target string) (string, error) {
+	return fn(target)
+}
+
+// AddPrefix returns a Rewriter which prepends the given prefix to every target
+func AddPrefix(prefix string) Rewriter {
+	return RewriterFunc(func(target string) (string, error) {
+		return prefix + target, nil
+	})
+}
+
+// StripPrefix returns a Rewriter which removes the given prefix from every target
+//
+// Targets without the prefix cause an error.
+func StripPrefix(prefix string) Rewriter {
+	return RewriterFunc(func(target string) (string, error) {
+		if !strings.HasPrefix(target, prefix) {
+			return "", fmt.Errorf("target %q does not start with prefix %q", target, prefix)
+		}
+		return strings.TrimPrefix(target, prefix), nil
+	})
+}
+
+// RegexpRename returns a Rewriter which replaces all matches of the regular expression
+//
+// The replacement may reference capture groups, see regexp.Regexp.ReplaceAllString.
+func RegexpRename(re *regexp.Regexp, replacement string) Rewriter {
+	return RewriterFunc(func(target string) (string, error) {
+		return re.ReplaceAllString(target, replacement), nil
+	})
+}
+
+// CollisionError is returned if multiple targets are rewritten to the same target
+type CollisionError struct {
+	Resource Resource
+	// Target is the target the sources were rewritten to
+	Target string
+	// Sources holds the sorted original targets
+	Sources []string
+}
+
+// Error implements error
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("%s targets %q collide at %q", e.Resource.String(), e.Sources, e.Target)
+}
+
+// TenantEscapeError is returned if a policy grants access outside of a tenant prefix
+type TenantEscapeError struct {
+	Resource Resource
+	Target   string
+	Prefix   string
+}
+
+// Error implements error
+func (e *TenantEscapeError) Error() string {
+	if e.Resource.IsGlobal() {
+		return fmt.Sprintf("%s grant escapes tenant prefix %q", e.Resource.String(), e.Prefix)
+	}
+	return fmt.Sprintf("%s target %q escapes tenant prefix %q", e.Resource.String(), e.Target, e.Prefix)
+}
+
+// Rewrite creates a copy of the policy with the targets of the given resources rewritten
+//
+// Targets of other resources as well as the keyring and operator grants are copied unchanged.
+// A CollisionError is returned if multiple targets of a resource are rewritten to the same target.
+func (p *Policy) Rewrite(rewriter Rewriter, resources ...Resource) (*Policy, error) {
+	clone := p.Clone()
+
+	for _, resource := range resources {
+		gm := clone.grantMap(resource)
+		if gm == nil {
+			continue
+		}
+
+		rewritten := make(map[string]Grant)
+		sources := make(map[string][]string)
+		for _, target := range gm.Targets() {
+			newTarget, err := rewriter.Rewrite(target)
+			if err != nil {
+				return nil, fmt.Errorf("%s target %q: %v", resource.String(), target, err)
+			}
+			rewritten[newTarget] = gm.Get(target)
+			sources[newTarget] = append(sources[newTarget], target)
+		}
+
+		for newTarget, targetSources := range sources {
+			if len(targetSources) > 1 {
+				sort.Strings(targetSources)
+				return nil, &CollisionError{
+					Resource: resource,
+					Target:   newTarget,
+					Sources:  targetSources,
+				}
+			}
+		}
+
+		*gm = GrantMap{}
+		for target, grant := range rewritten {
+			gm.Set(target, grant)
+		}
+	}
+
+	return clone, nil
+}
+
+// TenantSeparator is the separator every tenant prefix has to end with
+const TenantSeparator = "/"
+
+// validateTenantPrefix checks that the prefix is not empty and ends with TenantSeparator
+//
+// Without the trailing separator the prefix of one tenant is a prefix of others as well, e.g.
+// "tenants/1" of "tenants/10/".
+func validateTenantPrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("empty tenant prefix")
+	}
+	if !strings.HasSuffix(prefix, TenantSeparator) {
+		return fmt.Errorf("tenant prefix %q does not end with %q", prefix, TenantSeparator)
+	}
+	return nil
+}
+
+// ValidateTenant checks that the policy grants access to the given resources only below the tenant prefix
+//
+// The prefix has to end with TenantSeparator. Global grants which allow access (keyring and operator
+// read or write) escape every tenant. Denying targets outside the prefix only restrict access and are
+// allowed, matching the global grants. A TenantEscapeError is returned for the first violation found.
+func (p *Policy) ValidateTenant(prefix string, resources ...Resource) error {
+	if err := validateTenantPrefix(prefix); err != nil {
+		return err
+	}
+
+	for _, resource := range []Resource{ResourceKeyring, ResourceOperator} {
+		if grant := p.GetGrant(resource, ""); grant != GrantNone && grant != GrantDeny {
+			return &TenantEscapeError{Resource: resource, Prefix: prefix}
+		}
+	}
+
+	for _, resource := range resources {
+		gm := p.grantMap(resource)
+		if gm == nil {
+			continue
+		}
+		for _, target := range gm.Targets() {
+			if gm.Get(target) != GrantDeny && !strings.HasPrefix(target, prefix) {
+				return &TenantEscapeError{Resource: resource, Target: target, Prefix: prefix}
+			}
+		}
+	}
+
+	return nil
+}
+
+// RebaseTenant creates a copy of the policy with the targets of the given resources moved below the tenant prefix
+//
+// The prefix has to end with TenantSeparator, e.g. "tenants/<id>/", so the targets of one tenant cannot
+// match those of another one. The result is validated using ValidateTenant.
+func (p *Policy) RebaseTenant(prefix string, resources ...Resource) (*Policy, error) {
+	if err := validateTenantPrefix(prefix); err != nil {
+		return nil, err
+	}
+
+	rebased, err := p.Rewrite(AddPrefix(prefix), resources...)
+	if err != nil {
+		return nil, err
+	}
+	if err := rebased.ValidateTenant(prefix, resources...); err != nil {
+		return nil, err
+	}
+	return rebased, nil
+}
@@ -0,0 +1,159 @@
+package consulacl
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddPrefix(t *testing.T) {
+	target, err := AddPrefix("tenants/1/").Rewrite("app/config")
+	require.NoError(t, err)
+	assert.EqualValues(t, "tenants/1/app/config", target)
+}
+
+func TestStripPrefix(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		target, err := StripPrefix("tenants/1/").Rewrite("tenants/1/app/config")
+		require.NoError(t, err)
+		assert.EqualValues(t, "app/config", target)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		_, err := StripPrefix("tenants/1/").Rewrite("app/config")
+		assert.EqualError(t, err, `target "app/config" does not start with prefix "tenants/1/"`)
+	})
+}
+
+func TestRegexpRename(t *testing.T) {
+	target, err := RegexpRename(regexp.MustCompile(`^web-(\w+)$`), "frontend-$1").Rewrite("web-prod")
+	require.NoError(t, err)
+	assert.EqualValues(t, "frontend-prod", target)
+}
+
+func TestPolicy_Rewrite(t *testing.T) {
+	p := NewPolicy()
+	p.SetOperator(GrantRead)
+	p.Key().Set("app/", GrantWrite)
+	p.Key().Set("shared/", GrantRead)
+	p.Service().Set("web-prod", GrantWrite)
+	p.Service().Set("web-staging", GrantRead)
+
+	t.Run("OK", func(t *testing.T) {
+		rewritten, err := p.Rewrite(AddPrefix("tenants/1/"), ResourceKey, ResourceNone)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"tenants/1/app/", "tenants/1/shared/"}, rewritten.Key().Targets())
+		assert.EqualValues(t, GrantWrite, rewritten.Key().Get("tenants/1/app/"))
+		assert.EqualValues(t, GrantRead, rewritten.Key().Get("tenants/1/shared/"))
+		assert.EqualValues(t, []string{"web-prod", "web-staging"}, rewritten.Service().Targets())
+		assert.EqualValues(t, GrantRead, rewritten.GetOperator())
+
+		// Ensure the source is unaffected
+		assert.EqualValues(t, []string{"app/", "shared/"}, p.Key().Targets())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		rewritten, err := p.Rewrite(StripPrefix("app/"), ResourceKey)
+		assert.EqualError(t, err, `key target "shared/": target "shared/" does not start with prefix "app/"`)
+		assert.Nil(t, rewritten)
+	})
+
+	t.Run("Collision", func(t *testing.T) {
+		rewritten, err := p.Rewrite(RegexpRename(regexp.MustCompile(`-.*$`), ""), ResourceService)
+		require.IsType(t, &CollisionError{}, err)
+		assert.EqualValues(t, &CollisionError{
+			Resource: ResourceService,
+			Target:   "web",
+			Sources:  []string{"web-prod", "web-staging"},
+		}, err)
+		assert.EqualError(t, err, `service targets ["web-prod" "web-staging"] collide at "web"`)
+		assert.Nil(t, rewritten)
+	})
+}
+
+func TestPolicy_ValidateTenant(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		p := NewPolicy()
+		p.SetOperator(GrantDeny)
+		p.Key().Set("tenants/1/app", GrantWrite)
+		p.Service().Set("web", GrantRead)
+		assert.NoError(t, p.ValidateTenant("tenants/1/", ResourceKey))
+	})
+
+	t.Run("Target", func(t *testing.T) {
+		p := NewPolicy()
+		p.Key().Set("tenants/1/app", GrantWrite)
+		p.Key().Set("tenants/", GrantRead)
+		err := p.ValidateTenant("tenants/1/", ResourceKey)
+		assert.EqualValues(t, &TenantEscapeError{Resource: ResourceKey, Target: "tenants/", Prefix: "tenants/1/"}, err)
+		assert.EqualError(t, err, `key target "tenants/" escapes tenant prefix "tenants/1/"`)
+	})
+
+	t.Run("Deny", func(t *testing.T) {
+		p := NewPolicy()
+		p.Key().Set("tenants/1/app", GrantWrite)
+		p.Key().Set("tenants/", GrantDeny)
+		p.Key().Set("", GrantDeny)
+		assert.NoError(t, p.ValidateTenant("tenants/1/", ResourceKey))
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		p := NewPolicy()
+		p.Key().Set("tenants/1/app", GrantWrite)
+		assert.EqualError(t, p.ValidateTenant("", ResourceKey), "empty tenant prefix")
+		assert.EqualError(t, p.ValidateTenant("tenants/1", ResourceKey), `tenant prefix "tenants/1" does not end with "/"`)
+	})
+
+	t.Run("Global", func(t *testing.T) {
+		p := NewPolicy()
+		p.SetKeyring(GrantRead)
+		err := p.ValidateTenant("tenants/1/", ResourceKey)
+		assert.EqualValues(t, &TenantEscapeError{Resource: ResourceKeyring, Prefix: "tenants/1/"}, err)
+		assert.EqualError(t, err, `keyring grant escapes tenant prefix "tenants/1/"`)
+	})
+}
+
+func TestPolicy_RebaseTenant(t *testing.T) {
+	template := NewPolicy()
+	template.Key().Set("", GrantRead)
+	template.Key().Set("app/", GrantWrite)
+	template.Service().Set("web", GrantRead)
+
+	t.Run("OK", func(t *testing.T) {
+		rebased, err := template.RebaseTenant("tenants/1/", ResourceKey)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"tenants/1/", "tenants/1/app/"}, rebased.Key().Targets())
+		assert.EqualValues(t, []string{"web"}, rebased.Service().Targets())
+		assert.False(t, rebased.Allows(ResourceKey, "tenants/2/app/config", AccessRead))
+	})
+
+	t.Run("EmptyPrefix", func(t *testing.T) {
+		rebased, err := template.RebaseTenant("", ResourceKey)
+		assert.EqualError(t, err, "empty tenant prefix")
+		assert.Nil(t, rebased)
+	})
+
+	t.Run("PrefixWithoutSeparator", func(t *testing.T) {
+		p := NewPolicy()
+		p.Key().Set("", GrantWrite)
+		rebased, err := p.RebaseTenant("tenants/1", ResourceKey)
+		assert.EqualError(t, err, `tenant prefix "tenants/1" does not end with "/"`)
+		assert.Nil(t, rebased)
+
+		rebased, err = p.RebaseTenant("tenants/1/", ResourceKey)
+		require.NoError(t, err)
+		assert.True(t, rebased.Allows(ResourceKey, "tenants/1/secret", AccessWrite))
+		assert.False(t, rebased.Allows(ResourceKey, "tenants/10/secret", AccessWrite))
+		assert.False(t, rebased.Allows(ResourceKey, "tenants/10/secret", AccessRead))
+	})
+
+	t.Run("Escape", func(t *testing.T) {
+		p := template.Clone()
+		p.SetOperator(GrantWrite)
+		rebased, err := p.RebaseTenant("tenants/1/", ResourceKey)
+		assert.IsType(t, &TenantEscapeError{}, err)
+		assert.Nil(t, rebased)
+	})
+}
@@ -3,22 +3,34 @@ package consulacl
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+// quoteString quotes the string as HCL string literal
+//
+// Besides the escapes of strconv.Quote, the dollar sign of "${" is escaped, as HCL would start an
+// interpolation otherwise.
+func quoteString(s string) string {
+	return strings.Replace(strconv.Quote(s), "${", `\x24{`, -1)
+}
+
 type ruleGenerator interface {
 	generateRules(typePrefix string) string
 }
 
 // GenerateRules constructs a rules string from the defined policy
 func (p *Policy) GenerateRules() string {
+	// Generate the rules from a consistent snapshot
+	p = p.Clone()
+
 	var rules []string
-	if p.keyring != GrantNone {
-		rules = append(rules, fmt.Sprintf(`keyring = "%s"`, p.keyring.String()))
+	if keyring := p.GetKeyring(); keyring != GrantNone {
+		rules = append(rules, fmt.Sprintf(`keyring = "%s"`, keyring.String()))
 	}
 
-	if p.operator != GrantNone {
-		rules = append(rules, fmt.Sprintf(`operator = "%s"`, p.operator.String()))
+	if operator := p.GetOperator(); operator != GrantNone {
+		rules = append(rules, fmt.Sprintf(`operator = "%s"`, operator.String()))
 	}
 
 	generators := map[string]ruleGenerator{
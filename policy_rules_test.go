@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPolicy_GenerateRules(t *testing.T) {
@@ -101,4 +102,21 @@ session "session1" {
   policy = "write"
 }`, p.GenerateRules())
 	})
+
+	t.Run("Escaping", func(t *testing.T) {
+		p := NewPolicy()
+		p.Key().Set(`a"b`, GrantRead)
+		assert.EqualValues(t, `key "a\"b" {
+  policy = "read"
+}`, p.GenerateRules())
+
+		for _, target := range []string{`a"b`, `a\b`, "a\nb", "a\tb", "$", "a$b", "${a}", "${", `${"}`, `\${a}`, "a}b", "\x00"} {
+			p := NewPolicy()
+			p.Key().Set(target, GrantWrite)
+			parsed, err := NewPolicyFromRules(p.GenerateRules())
+			require.NoError(t, err, target)
+			assert.True(t, parsed.Equals(p), target)
+			assert.EqualValues(t, GrantWrite, parsed.Key().Get(target), target)
+		}
+	})
 }
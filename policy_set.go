@@ -0,0 +1,122 @@
+package consulacl
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// PolicySet holds a collection of named policies, e.g. the policies of all tokens
+type PolicySet struct {
+	mu       sync.RWMutex
+	policies map[string]*Policy
+}
+
+// NewPolicySet constructs a new, empty policy set
+func NewPolicySet() *PolicySet {
+	return &PolicySet{}
+}
+
+// Set stores the policy under the given name
+//
+// This method overrides a potentially existing policy
+func (s *PolicySet) Set(name string, p *Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policies == nil {
+		s.policies = make(map[string]*Policy, 16)
+	}
+	s.policies[name] = p
+}
+
+// Remove removes the policy stored under the given name
+func (s *PolicySet) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.policies, name)
+}
+
+// Get retrieves the policy stored under the given name
+//
+// nil is returned if no policy by the given name exists
+func (s *PolicySet) Get(name string) *Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policies[name]
+}
+
+// Len returns the number of policies in the set
+func (s *PolicySet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.policies)
+}
+
+// Names returns the sorted names of all policies in the set
+func (s *PolicySet) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.policies))
+	for name := range s.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Find returns the sorted names of all policies for which fn returns true
+func (s *PolicySet) Find(fn func(name string, p *Policy) bool) []string {
+	var names []string
+	for _, name := range s.Names() {
+		if p := s.Get(name); p != nil && fn(name, p) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// WhoCan returns the sorted names of all policies which allow the given access to a target of a resource
+//
+// Targets are matched using prefix semantics, see Policy.Evaluate. For global resources the target is ignored.
+func (s *PolicySet) WhoCan(resource Resource, target string, access Access) []string {
+	return s.Find(func(_ string, p *Policy) bool {
+		return p.Allows(resource, target, access)
+	})
+}
+
+// ACLEntryKeyFunc defines the function type used to derive a policy name from an ACL entry
+type ACLEntryKeyFunc func(entry *api.ACLEntry) string
+
+// ACLEntryName uses the name of the ACL entry as policy name
+func ACLEntryName(entry *api.ACLEntry) string {
+	return entry.Name
+}
+
+// ACLEntryID uses the ID of the ACL entry as policy name
+func ACLEntryID(entry *api.ACLEntry) string {
+	return entry.ID
+}
+
+// NewPolicySetFromACLEntries constructs a new policy set from ACL entries as returned by api.ACL.List
+//
+// The name of each policy is derived using the key function. Management tokens are included with the
+// policy represented by their rules only, the implicit full access of such tokens is not reflected.
+func NewPolicySetFromACLEntries(entries []*api.ACLEntry, key ACLEntryKeyFunc) (*PolicySet, error) {
+	s := NewPolicySet()
+	for _, entry := range entries {
+		name := key(entry)
+		if s.Get(name) != nil {
+			return nil, fmt.Errorf("duplicate policy name %q", name)
+		}
+
+		p, err := NewPolicyFromRules(entry.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %v", name, err)
+		}
+		s.Set(name, p)
+	}
+	return s, nil
+}
@@ -0,0 +1,331 @@
+package consulacl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// PolicyFileExtension defines the file extension of policy rule files
+const PolicyFileExtension = ".hcl"
+
+// includePattern matches include directives in policy rule files, e.g. `# include "base"`
+var includePattern = regexp.MustCompile(`^\s*(?:#|//)\s*include\s+"([^"]+)"\s*$`)
+
+// LoadError describes an error which occurred while loading a policy rule file
+type LoadError struct {
+	// File is the path of the file
+	File string
+	// Line is the line the error occurred at, zero if unknown
+	Line int
+	// Column is the column the error occurred at, zero if unknown
+	Column int
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error
+func (e *LoadError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+// LoadErrors holds all errors which occurred while loading a directory of policy rule files
+type LoadErrors []*LoadError
+
+// Error implements error
+func (e LoadErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+type policyInclude struct {
+	name string
+	line int
+}
+
+type policySource struct {
+	file     string
+	policy   *Policy
+	includes []policyInclude
+}
+
+// NewPolicySetFromDir constructs a new policy set from a directory tree of policy rule files
+//
+// Every file with the PolicyFileExtension is loaded as a policy named by its path relative to dir,
+// without the extension and using forward slashes. A file may compose other policies by adding
+// `# include "<name>"` lines. Included policies are applied in order, the rules of the including
+// file override them.
+//
+// Loading continues after errors, all errors are returned as LoadErrors.
+func NewPolicySetFromDir(dir string) (*PolicySet, error) {
+	var errs LoadErrors
+	sources := make(map[string]*policySource)
+	var names []string
+
+	walkErr := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(file) != PolicyFileExtension {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), PolicyFileExtension)
+
+		source, loadErr := loadPolicySource(file)
+		if loadErr != nil {
+			errs = append(errs, loadErr)
+		}
+		sources[name] = source
+		names = append(names, name)
+		return nil
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	s := NewPolicySet()
+	resolved := make(map[string]*Policy, len(sources))
+	visiting := make(map[string]bool)
+
+	var resolve func(name string) *Policy
+	resolve = func(name string) *Policy {
+		if p, done := resolved[name]; done {
+			return p
+		}
+		source := sources[name]
+		if source.policy == nil {
+			resolved[name] = nil
+			return nil
+		}
+
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		p := NewPolicy()
+		for _, include := range source.includes {
+			if _, exists := sources[include.name]; !exists {
+				errs = append(errs, &LoadError{File: source.file, Line: include.line, Column: 1, Err: fmt.Errorf("included policy %q not found", include.name)})
+				p = nil
+				continue
+			}
+			if visiting[include.name] {
+				errs = append(errs, &LoadError{File: source.file, Line: include.line, Column: 1, Err: fmt.Errorf("include cycle detected at policy %q", include.name)})
+				p = nil
+				continue
+			}
+
+			included := resolve(include.name)
+			if included == nil || p == nil {
+				p = nil
+				continue
+			}
+			p.Merge(included)
+		}
+		if p != nil {
+			p.Merge(source.policy)
+		}
+
+		resolved[name] = p
+		return p
+	}
+
+	for _, name := range names {
+		if p := resolve(name); p != nil {
+			s.Set(name, p)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return s, nil
+}
+
+// loadPolicySource reads and parses a single policy rule file
+func loadPolicySource(file string) (*policySource, *LoadError) {
+	source := &policySource{
+		file: file,
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return source, &LoadError{File: file, Err: err}
+	}
+	rules := string(data)
+
+	for i, line := range strings.Split(rules, "\n") {
+		if match := includePattern.FindStringSubmatch(line); match != nil {
+			source.includes = append(source.includes, policyInclude{
+				name: match[1],
+				line: i + 1,
+			})
+		}
+	}
+
+	// Parse the rules first to retrieve the position of syntax errors
+	f, err := hcl.Parse(rules)
+	if err != nil {
+		loadErr := &LoadError{File: file, Err: err}
+		if posErr, ok := err.(*hclParser.PosError); ok {
+			loadErr.Line = posErr.Pos.Line
+			loadErr.Column = posErr.Pos.Column
+			loadErr.Err = posErr.Err
+		}
+		return source, loadErr
+	}
+
+	// Validate the policies before decoding, as the errors of the consul parser lack a position
+	if pos, err := findInvalidRule(f); err != nil {
+		return source, &LoadError{File: file, Line: pos.Line, Column: pos.Column, Err: err}
+	}
+
+	p, err := NewPolicyFromRules(rules)
+	if err != nil {
+		return source, &LoadError{File: file, Err: err}
+	}
+	source.policy = p
+
+	return source, nil
+}
+
+// WriteDir writes all policies of the set to a directory tree of policy rule files
+//
+// The policies are written in their canonical form as returned by Policy.GenerateRules, the
+// resulting tree can be loaded again using NewPolicySetFromDir.
+func (s *PolicySet) WriteDir(dir string) error {
+	for _, name := range s.Names() {
+		if err := validatePolicyName(name); err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(name)+PolicyFileExtension)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		rules := s.Get(name).GenerateRules()
+		if rules != "" {
+			rules += "\n"
+		}
+		if err := ioutil.WriteFile(file, []byte(rules), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePolicyName checks if the name can be used as a relative, slash-separated path
+func validatePolicyName(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "../") || name == ".." {
+		return fmt.Errorf("invalid policy name %q", name)
+	}
+	return nil
+}
+
+// findInvalidRule returns the position of the first rule in f whose policy is rejected by consul
+func findInvalidRule(f *ast.File) (token.Pos, error) {
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return token.Pos{}, nil
+	}
+
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			continue
+		}
+		resource, _ := item.Keys[0].Token.Value().(string)
+
+		switch resource {
+		case "keyring", "operator":
+			// An empty policy is allowed for the global resources
+			if policy, ok := literalString(item.Val); ok && policy != "" && !isValidRulePolicy(resource, policy) {
+				return item.Val.Pos(), fmt.Errorf("invalid %s policy %q", resource, policy)
+			}
+		case "agent", "key", "node", "service", "session", "event", "query":
+			if len(item.Keys) > 1 {
+				target, _ := item.Keys[1].Token.Value().(string)
+				if pos, err := checkRuleBlock(resource, target, item); err != nil {
+					return pos, err
+				}
+				continue
+			}
+
+			// Rules may also be nested, e.g. `key { "app/" { policy = "read" } }`
+			object, ok := item.Val.(*ast.ObjectType)
+			if !ok {
+				continue
+			}
+			for _, nested := range object.List.Items {
+				if len(nested.Keys) == 0 {
+					continue
+				}
+				target, _ := nested.Keys[0].Token.Value().(string)
+				if pos, err := checkRuleBlock(resource, target, nested); err != nil {
+					return pos, err
+				}
+			}
+		}
+	}
+
+	return token.Pos{}, nil
+}
+
+// checkRuleBlock validates the policy of a single rule block
+func checkRuleBlock(resource, target string, item *ast.ObjectItem) (token.Pos, error) {
+	object, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return token.Pos{}, nil
+	}
+
+	policies := object.List.Filter("policy").Items
+	if len(policies) == 0 {
+		return item.Pos(), fmt.Errorf("missing policy for %s %q", resource, target)
+	}
+	policyItem := policies[len(policies)-1]
+	policy, ok := literalString(policyItem.Val)
+	if ok && !isValidRulePolicy(resource, policy) {
+		return policyItem.Val.Pos(), fmt.Errorf("invalid policy %q for %s %q", policy, resource, target)
+	}
+	return token.Pos{}, nil
+}
+
+// literalString returns the value of node if it is a string literal
+func literalString(node ast.Node) (string, bool) {
+	literal, ok := node.(*ast.LiteralType)
+	if !ok || literal.Token.Type != token.STRING {
+		return "", false
+	}
+	value, ok := literal.Token.Value().(string)
+	return value, ok
+}
+
+// isValidRulePolicy returns whether consul accepts policy for the given resource
+func isValidRulePolicy(resource, policy string) bool {
+	switch policy {
+	case "read", "write", "deny":
+		return true
+	case "list":
+		return resource == "key"
+	}
+	return false
+}
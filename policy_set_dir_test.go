@@ -0,0 +1,181 @@
+package consulacl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicyFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "consulacl")
+	require.NoError(t, err)
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestLoadError_Error(t *testing.T) {
+	err := &LoadError{File: "test.hcl", Err: assert.AnError}
+	assert.EqualValues(t, "test.hcl: "+assert.AnError.Error(), err.Error())
+
+	err.Line = 3
+	err.Column = 5
+	assert.EqualValues(t, "test.hcl:3:5: "+assert.AnError.Error(), err.Error())
+
+	errs := LoadErrors{err, &LoadError{File: "other.hcl", Err: assert.AnError}}
+	assert.EqualValues(t, "test.hcl:3:5: "+assert.AnError.Error()+"\nother.hcl: "+assert.AnError.Error(), errs.Error())
+}
+
+func TestNewPolicySetFromDir(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dir := writePolicyFiles(t, map[string]string{
+			"base.hcl": `key "" {
+  policy = "read"
+}`,
+			"team/web.hcl": `# include "base"
+service "web" {
+  policy = "write"
+}
+key "" {
+  policy = "deny"
+}`,
+			"team/ops.hcl": `// include "team/web"
+operator = "write"`,
+			"README.md": "ignored",
+		})
+		defer os.RemoveAll(dir)
+
+		s, err := NewPolicySetFromDir(dir)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"base", "team/ops", "team/web"}, s.Names())
+
+		assert.EqualValues(t, GrantRead, s.Get("base").Key().Get(""))
+
+		web := s.Get("team/web")
+		assert.EqualValues(t, GrantDeny, web.Key().Get(""))
+		assert.EqualValues(t, GrantWrite, web.Service().Get("web"))
+
+		ops := s.Get("team/ops")
+		assert.EqualValues(t, GrantWrite, ops.GetOperator())
+		assert.EqualValues(t, GrantDeny, ops.Key().Get(""))
+		assert.EqualValues(t, GrantWrite, ops.Service().Get("web"))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		dir := writePolicyFiles(t, map[string]string{
+			"syntax.hcl": `key "test" {
+  policy = "read"
+`,
+			"invalid.hcl": `key "test" {
+  policy = "invalid"
+}`,
+			"nested.hcl": `service "web" {
+  policy = "read"
+}
+key {
+  "y" {
+    policy = "wrte"
+  }
+}`,
+			"global.hcl": `
+operator = "list"`,
+			"missing.hcl": `
+# include "unknown"`,
+			"cycle0.hcl": `# include "cycle1"`,
+			"cycle1.hcl": `# include "cycle0"`,
+			"broken.hcl": `# include "syntax"`,
+			"valid.hcl":  `operator = "read"`,
+		})
+		defer os.RemoveAll(dir)
+
+		s, err := NewPolicySetFromDir(dir)
+		assert.Nil(t, s)
+		require.IsType(t, LoadErrors{}, err)
+
+		errs := err.(LoadErrors)
+		require.Len(t, errs, 6)
+
+		messages := make(map[string]*LoadError)
+		for _, loadErr := range errs {
+			rel, relErr := filepath.Rel(dir, loadErr.File)
+			require.NoError(t, relErr)
+			messages[rel] = loadErr
+		}
+
+		require.Contains(t, messages, "syntax.hcl")
+		assert.EqualValues(t, 3, messages["syntax.hcl"].Line)
+
+		require.Contains(t, messages, "invalid.hcl")
+		assert.EqualValues(t, 2, messages["invalid.hcl"].Line)
+		assert.EqualValues(t, 12, messages["invalid.hcl"].Column)
+		assert.EqualError(t, messages["invalid.hcl"].Err, `invalid policy "invalid" for key "test"`)
+
+		require.Contains(t, messages, "nested.hcl")
+		assert.EqualValues(t, 6, messages["nested.hcl"].Line)
+		assert.EqualError(t, messages["nested.hcl"].Err, `invalid policy "wrte" for key "y"`)
+
+		require.Contains(t, messages, "global.hcl")
+		assert.EqualValues(t, 2, messages["global.hcl"].Line)
+		assert.EqualError(t, messages["global.hcl"].Err, `invalid operator policy "list"`)
+
+		require.Contains(t, messages, "missing.hcl")
+		assert.EqualValues(t, 2, messages["missing.hcl"].Line)
+		assert.EqualError(t, messages["missing.hcl"].Err, `included policy "unknown" not found`)
+
+		require.Contains(t, messages, "cycle1.hcl")
+		assert.EqualError(t, messages["cycle1.hcl"].Err, `include cycle detected at policy "cycle0"`)
+	})
+
+	t.Run("NotExisting", func(t *testing.T) {
+		s, err := NewPolicySetFromDir(filepath.Join(os.TempDir(), "consulacl-not-existing"))
+		assert.Error(t, err)
+		assert.Nil(t, s)
+	})
+}
+
+func TestPolicySet_WriteDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("OK", func(t *testing.T) {
+		s := NewPolicySet()
+		web := NewPolicy()
+		web.Service().Set("web", GrantWrite)
+		web.SetOperator(GrantRead)
+		s.Set("team/web", web)
+		s.Set("empty", NewPolicy())
+
+		require.NoError(t, s.WriteDir(dir))
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "team", "web.hcl"))
+		require.NoError(t, err)
+		assert.EqualValues(t, web.GenerateRules()+"\n", string(data))
+
+		data, err = ioutil.ReadFile(filepath.Join(dir, "empty.hcl"))
+		require.NoError(t, err)
+		assert.Empty(t, data)
+
+		// Ensure the written set loads again
+		loaded, err := NewPolicySetFromDir(dir)
+		require.NoError(t, err)
+		assert.EqualValues(t, s.Names(), loaded.Names())
+		assert.True(t, loaded.Get("team/web").Equals(web))
+	})
+
+	t.Run("InvalidName", func(t *testing.T) {
+		for _, name := range []string{"", "../escape", "/absolute", "a/../b"} {
+			s := NewPolicySet()
+			s.Set(name, NewPolicy())
+			assert.EqualError(t, s.WriteDir(dir), `invalid policy name "`+name+`"`)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicySet(t *testing.T) {
+	s := NewPolicySet()
+	require.NotNil(t, s)
+	assert.EqualValues(t, 0, s.Len())
+}
+
+func TestPolicySet_Set(t *testing.T) {
+	s := PolicySet{}
+	p := NewPolicy()
+	s.Set("test", p)
+	require.NotNil(t, s.policies)
+	assert.True(t, s.policies["test"] == p)
+}
+
+func TestPolicySet_Remove(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		s := PolicySet{}
+		s.Remove("test")
+		assert.Nil(t, s.policies)
+	})
+
+	t.Run("Existing", func(t *testing.T) {
+		s := PolicySet{}
+		s.Set("test", NewPolicy())
+		s.Remove("test")
+		assert.Len(t, s.policies, 0)
+	})
+}
+
+func TestPolicySet_Get(t *testing.T) {
+	s := PolicySet{}
+	assert.Nil(t, s.Get("test"))
+
+	p := NewPolicy()
+	s.Set("test", p)
+	assert.True(t, s.Get("test") == p)
+}
+
+func TestPolicySet_Names(t *testing.T) {
+	s := PolicySet{}
+	assert.Empty(t, s.Names())
+	assert.EqualValues(t, 0, s.Len())
+
+	s.Set("test1", NewPolicy())
+	s.Set("test0", NewPolicy())
+	assert.EqualValues(t, []string{"test0", "test1"}, s.Names())
+	assert.EqualValues(t, 2, s.Len())
+}
+
+func TestPolicySet_WhoCan(t *testing.T) {
+	s := PolicySet{}
+
+	ops := NewPolicy()
+	ops.SetOperator(GrantWrite)
+	ops.Key().Set("", GrantWrite)
+	s.Set("ops", ops)
+
+	vault := NewPolicy()
+	vault.Key().Set("vault/", GrantWrite)
+	s.Set("vault", vault)
+
+	reader := NewPolicy()
+	reader.SetOperator(GrantRead)
+	reader.Key().Set("vault", GrantRead)
+	s.Set("reader", reader)
+
+	assert.EqualValues(t, []string{"ops", "vault"}, s.WhoCan(ResourceKey, "vault/", AccessWrite))
+	assert.EqualValues(t, []string{"ops", "reader", "vault"}, s.WhoCan(ResourceKey, "vault/data", AccessRead))
+	assert.EqualValues(t, []string{"ops"}, s.WhoCan(ResourceKey, "other", AccessRead))
+	assert.EqualValues(t, []string{"ops"}, s.WhoCan(ResourceOperator, "", AccessWrite))
+	assert.EqualValues(t, []string{"ops", "reader"}, s.WhoCan(ResourceOperator, "", AccessRead))
+	assert.Empty(t, s.WhoCan(ResourceService, "web", AccessRead))
+}
+
+func TestNewPolicySetFromACLEntries(t *testing.T) {
+	entries := []*api.ACLEntry{
+		{
+			ID:    "id0",
+			Name:  "token0",
+			Type:  api.ACLClientType,
+			Rules: `key "test" { policy = "read" }`,
+		},
+		{
+			ID:    "id1",
+			Name:  "token1",
+			Type:  api.ACLManagementType,
+			Rules: "",
+		},
+	}
+
+	t.Run("ByName", func(t *testing.T) {
+		s, err := NewPolicySetFromACLEntries(entries, ACLEntryName)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"token0", "token1"}, s.Names())
+		assert.True(t, s.Get("token0").Key().Is("test", GrantRead))
+	})
+
+	t.Run("ByID", func(t *testing.T) {
+		s, err := NewPolicySetFromACLEntries(entries, ACLEntryID)
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"id0", "id1"}, s.Names())
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		s, err := NewPolicySetFromACLEntries(append(entries, &api.ACLEntry{ID: "id2", Name: "token0"}), ACLEntryName)
+		assert.EqualError(t, err, `duplicate policy name "token0"`)
+		assert.Nil(t, s)
+	})
+
+	t.Run("ParseError", func(t *testing.T) {
+		s, err := NewPolicySetFromACLEntries([]*api.ACLEntry{{ID: "id0", Rules: `agent = "read"`}}, ACLEntryID)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `policy "id0": `)
+		assert.Nil(t, s)
+	})
+}
@@ -1,6 +1,7 @@
 package consulacl
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/hashicorp/consul/acl"
@@ -377,3 +378,85 @@ func TestPolicy_Clone(t *testing.T) {
 	// Ensure that clone and source are not equal anymore
 	assert.False(t, clone.Equals(source))
 }
+
+func TestPolicy_Merge(t *testing.T) {
+	p := &Policy{}
+	p.keyring = GrantRead
+	p.operator = GrantRead
+	p.key.Set("key0", GrantRead)
+	p.key.Set("key1", GrantRead)
+	p.service.Set("service0", GrantRead)
+
+	other := &Policy{}
+	other.operator = GrantWrite
+	other.key.Set("key1", GrantWrite)
+	other.node.Set("node0", GrantDeny)
+
+	p.Merge(other)
+	assert.EqualValues(t, GrantRead, p.keyring)
+	assert.EqualValues(t, GrantWrite, p.operator)
+	assert.EqualValues(t, GrantRead, p.key.Get("key0"))
+	assert.EqualValues(t, GrantWrite, p.key.Get("key1"))
+	assert.EqualValues(t, GrantRead, p.service.Get("service0"))
+	assert.EqualValues(t, GrantDeny, p.node.Get("node0"))
+
+	// Ensure the other policy is unaffected
+	assert.False(t, other.key.Is("key0", GrantRead))
+	assert.EqualValues(t, GrantNone, other.keyring)
+}
+
+func TestPolicy_SetGrant(t *testing.T) {
+	p := &Policy{}
+	p.SetGrant(ResourceKeyring, "ignored", GrantRead)
+	p.SetGrant(ResourceOperator, "", GrantWrite)
+	p.SetGrant(ResourceNone, "test0", GrantWrite)
+	for _, resource := range TargetResources {
+		p.SetGrant(resource, "test0", GrantDeny)
+	}
+
+	assert.EqualValues(t, GrantRead, p.keyring)
+	assert.EqualValues(t, GrantWrite, p.operator)
+	for _, resource := range TargetResources {
+		assert.EqualValues(t, GrantDeny, p.grantMap(resource).Get("test0"), resource.String())
+	}
+}
+
+func TestPolicy_GetGrant(t *testing.T) {
+	p := &Policy{
+		keyring:  GrantRead,
+		operator: GrantWrite,
+	}
+	p.service.Set("test0", GrantDeny)
+
+	assert.EqualValues(t, GrantRead, p.GetGrant(ResourceKeyring, "ignored"))
+	assert.EqualValues(t, GrantWrite, p.GetGrant(ResourceOperator, ""))
+	assert.EqualValues(t, GrantDeny, p.GetGrant(ResourceService, "test0"))
+	assert.EqualValues(t, GrantNone, p.GetGrant(ResourceService, "test1"))
+	assert.EqualValues(t, GrantNone, p.GetGrant(ResourceNone, "test0"))
+}
+
+func TestPolicy_ConcurrentGlobalGrants(t *testing.T) {
+	p := NewPolicy()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			p.SetKeyring(GrantRead)
+			p.SetOperator(GrantWrite)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			p.Allows(ResourceKeyring, "", AccessRead)
+			p.Clone()
+			p.GenerateRules()
+		}
+	}()
+	wg.Wait()
+
+	assert.EqualValues(t, GrantRead, p.GetKeyring())
+	assert.EqualValues(t, GrantWrite, p.GetOperator())
+}
@@ -0,0 +1,143 @@
+package consulacl
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/acl"
+)
+
+// ValidateFunc defines the function type used to validate a policy before an update is committed
+type ValidateFunc func(p *Policy) error
+
+// ValidateConsulRules checks if consul accepts the rules generated from the policy
+//
+// This catches grants consul does not support, e.g. list grants on resources other than keys.
+func ValidateConsulRules(p *Policy) error {
+	if _, err := acl.Parse(p.GenerateRules(), nil); err != nil {
+		return fmt.Errorf("policy rejected by consul: %v", err)
+	}
+	return nil
+}
+
+// PolicyTx stages changes to a policy, see Policy.Update
+type PolicyTx struct {
+	staged  *Policy
+	changes []Rule
+}
+
+// Set stages the grant for a target of the given resource
+//
+// For global resources (keyring and operator) the target is ignored. Setting GrantNone removes the target.
+// Invalid resources are ignored.
+func (tx *PolicyTx) Set(resource Resource, target string, grant Grant) {
+	if resource == ResourceNone || resource >= resourceMax {
+		return
+	}
+	if resource.IsGlobal() {
+		target = ""
+	}
+	tx.staged.SetGrant(resource, target, grant)
+	tx.changes = append(tx.changes, Rule{Resource: resource, Target: target, Grant: grant})
+}
+
+// Remove stages the removal of the grant for a target of the given resource
+func (tx *PolicyTx) Remove(resource Resource, target string) {
+	tx.Set(resource, target, GrantNone)
+}
+
+// SetKeyring stages the keyring grant
+func (tx *PolicyTx) SetKeyring(grant Grant) {
+	tx.Set(ResourceKeyring, "", grant)
+}
+
+// SetOperator stages the operator grant
+func (tx *PolicyTx) SetOperator(grant Grant) {
+	tx.Set(ResourceOperator, "", grant)
+}
+
+// Get retrieves the staged grant for a target of the given resource
+func (tx *PolicyTx) Get(resource Resource, target string) Grant {
+	return tx.staged.GetGrant(resource, target)
+}
+
+// Policy returns a copy of the policy as it looks with all staged changes applied
+func (tx *PolicyTx) Policy() *Policy {
+	return tx.staged.Clone()
+}
+
+// Update applies the changes staged by fn to the policy atomically
+//
+// If fn returns an error no changes are applied and the error is returned. Otherwise the staged changes
+// are applied to the current state of the policy and the result is checked by the validators. If a
+// validator fails no changes are applied and the validator error is returned. Validators must not access
+// the policy being updated.
+//
+// All changes become visible at once to Clone and all functions operating on a snapshot of the policy.
+// Observers are notified after the changes have been applied.
+func (p *Policy) Update(fn func(tx *PolicyTx) error, validators ...ValidateFunc) error {
+	tx := &PolicyTx{
+		staged: p.Clone(),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	// Lock the policy and all embedded GrantMap instances in the same order as Clone does
+	p.mu.Lock()
+	for _, resource := range TargetResources {
+		p.grantMap(resource).mu.Lock()
+	}
+	unlock := func() {
+		for i := len(TargetResources) - 1; i >= 0; i-- {
+			p.grantMap(TargetResources[i]).mu.Unlock()
+		}
+		p.mu.Unlock()
+	}
+
+	// Validate the result of applying the changes to the current state
+	result := p.cloneLocked()
+	for _, change := range tx.changes {
+		result.SetGrant(change.Resource, change.Target, change.Grant)
+	}
+	for _, validate := range validators {
+		if err := validate(result); err != nil {
+			unlock()
+			return err
+		}
+	}
+
+	// Apply the changes and collect the notifications
+	var notifications []func()
+	for _, change := range tx.changes {
+		change := change
+		switch change.Resource {
+		case ResourceKeyring, ResourceOperator:
+			c := Change{Resource: change.Resource, New: change.Grant}
+			if change.Resource == ResourceKeyring {
+				c.Type, c.Old, p.keyring = ChangeKeyring, p.keyring, change.Grant
+			} else {
+				c.Type, c.Old, p.operator = ChangeOperator, p.operator, change.Grant
+			}
+			if c.Old != c.New {
+				observers := p.observers
+				notifications = append(notifications, func() {
+					notifyPolicyObservers(observers, c)
+				})
+			}
+		default:
+			gm := p.grantMap(change.Resource)
+			if c, changed := gm.setLocked(change.Target, change.Grant); changed {
+				observers := gm.observers
+				notifications = append(notifications, func() {
+					notifyGrantObservers(observers, c)
+				})
+			}
+		}
+	}
+	unlock()
+
+	for _, notify := range notifications {
+		notify()
+	}
+	return nil
+}
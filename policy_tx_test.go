@@ -0,0 +1,208 @@
+package consulacl
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConsulRules(t *testing.T) {
+	p := NewPolicy()
+	p.Key().Set("app/", GrantList)
+	assert.NoError(t, ValidateConsulRules(p))
+
+	p.Service().Set("web", GrantList)
+	err := ValidateConsulRules(p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "policy rejected by consul: Invalid service policy")
+}
+
+func TestPolicyTx(t *testing.T) {
+	p := NewPolicy()
+	p.Key().Set("app/", GrantRead)
+
+	tx := &PolicyTx{staged: p.Clone()}
+	tx.Set(ResourceKey, "app/", GrantWrite)
+	tx.Set(ResourceNone, "ignored", GrantWrite)
+	tx.Remove(ResourceKey, "app/")
+	tx.SetKeyring(GrantRead)
+	tx.SetOperator(GrantWrite)
+	tx.Set(ResourceOperator, "ignored", GrantDeny)
+
+	assert.EqualValues(t, []Rule{
+		{Resource: ResourceKey, Target: "app/", Grant: GrantWrite},
+		{Resource: ResourceKey, Target: "app/", Grant: GrantNone},
+		{Resource: ResourceKeyring, Grant: GrantRead},
+		{Resource: ResourceOperator, Grant: GrantWrite},
+		{Resource: ResourceOperator, Grant: GrantDeny},
+	}, tx.changes)
+
+	assert.EqualValues(t, GrantNone, tx.Get(ResourceKey, "app/"))
+	assert.EqualValues(t, GrantDeny, tx.Get(ResourceOperator, ""))
+
+	staged := tx.Policy()
+	assert.EqualValues(t, GrantRead, staged.GetKeyring())
+	staged.SetKeyring(GrantWrite)
+	assert.EqualValues(t, GrantRead, tx.Get(ResourceKeyring, ""))
+
+	// Ensure the policy itself is unaffected
+	assert.EqualValues(t, GrantRead, p.Key().Get("app/"))
+	assert.EqualValues(t, GrantNone, p.GetKeyring())
+}
+
+func TestPolicy_Update(t *testing.T) {
+	newPolicy := func() *Policy {
+		p := NewPolicy()
+		p.SetOperator(GrantRead)
+		p.Key().Set("app/", GrantRead)
+		p.Service().Set("web", GrantWrite)
+		return p
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		p := newPolicy()
+
+		var changes []Change
+		p.OnChange(func(c Change) {
+			// Ensure no locks are held while notifying
+			p.Clone()
+			changes = append(changes, c)
+		})
+
+		err := p.Update(func(tx *PolicyTx) error {
+			tx.Set(ResourceKey, "app/", GrantWrite)
+			tx.Set(ResourceKey, "tmp/", GrantRead)
+			tx.Set(ResourceKey, "tmp/", GrantRead)
+			tx.Remove(ResourceService, "web")
+			tx.SetOperator(GrantWrite)
+			tx.SetKeyring(GrantNone)
+			return nil
+		}, ValidateConsulRules)
+		require.NoError(t, err)
+
+		assert.EqualValues(t, GrantWrite, p.Key().Get("app/"))
+		assert.EqualValues(t, GrantRead, p.Key().Get("tmp/"))
+		assert.EqualValues(t, GrantNone, p.Service().Get("web"))
+		assert.EqualValues(t, GrantWrite, p.GetOperator())
+
+		assert.EqualValues(t, []Change{
+			{Type: ChangeSet, Resource: ResourceKey, Target: "app/", Old: GrantRead, New: GrantWrite},
+			{Type: ChangeSet, Resource: ResourceKey, Target: "tmp/", Old: GrantNone, New: GrantRead},
+			{Type: ChangeRemove, Resource: ResourceService, Target: "web", Old: GrantWrite, New: GrantNone},
+			{Type: ChangeOperator, Resource: ResourceOperator, Old: GrantRead, New: GrantWrite},
+		}, changes)
+	})
+
+	t.Run("FuncError", func(t *testing.T) {
+		p := newPolicy()
+		expectedErr := errors.New("test error")
+
+		err := p.Update(func(tx *PolicyTx) error {
+			tx.Set(ResourceKey, "app/", GrantWrite)
+			return expectedErr
+		})
+		assert.EqualValues(t, expectedErr, err)
+		assert.True(t, p.Equals(newPolicy()))
+	})
+
+	t.Run("ValidationError", func(t *testing.T) {
+		p := newPolicy()
+
+		var validated *Policy
+		err := p.Update(func(tx *PolicyTx) error {
+			tx.Set(ResourceKey, "app/", GrantWrite)
+			tx.Set(ResourceService, "web", GrantList)
+			return nil
+		}, func(result *Policy) error {
+			validated = result
+			return nil
+		}, ValidateConsulRules)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Invalid service policy")
+		assert.True(t, p.Equals(newPolicy()))
+
+		require.NotNil(t, validated)
+		assert.EqualValues(t, GrantWrite, validated.Key().Get("app/"))
+	})
+
+	t.Run("ConcurrentChanges", func(t *testing.T) {
+		p := newPolicy()
+
+		err := p.Update(func(tx *PolicyTx) error {
+			// Changes applied while staging are preserved
+			p.Node().Set("node0", GrantRead)
+			tx.Set(ResourceKey, "app/", GrantWrite)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, GrantRead, p.Node().Get("node0"))
+		assert.EqualValues(t, GrantWrite, p.Key().Get("app/"))
+	})
+
+	t.Run("Atomic", func(t *testing.T) {
+		p := NewPolicy()
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// Both grants are always changed together
+				snapshot := p.Clone()
+				assert.EqualValues(t, snapshot.Key().Get("test"), snapshot.Service().Get("test"))
+				assert.EqualValues(t, snapshot.Key().Get("test"), snapshot.GetOperator())
+			}
+		}()
+
+		for i := 0; i < 200; i++ {
+			grant := Grant(GrantRead)
+			if i%2 == 0 {
+				grant = GrantWrite
+			}
+			require.NoError(t, p.Update(func(tx *PolicyTx) error {
+				tx.Set(ResourceKey, "test", grant)
+				tx.Set(ResourceService, "test", grant)
+				tx.SetOperator(grant)
+				return nil
+			}))
+		}
+		close(done)
+		wg.Wait()
+	})
+}
+
+func TestPolicy_EqualsConcurrent(t *testing.T) {
+	a, b := NewPolicy(), NewPolicy()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				switch i {
+				case 0:
+					a.Equals(b)
+				case 1:
+					b.Equals(a)
+				case 2:
+					a.Key().Set("test", GrantRead)
+				case 3:
+					b.Key().Set("test", GrantRead)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.True(t, a.Equals(b))
+}
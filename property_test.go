@@ -0,0 +1,166 @@
+package consulacl_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/anexia-it/consulacl/consulacltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// propertyIterations defines the number of random policies every property is checked with
+const propertyIterations = 500
+
+var propertyAccesses = []consulacl.Access{consulacl.AccessList, consulacl.AccessRead, consulacl.AccessWrite}
+
+// requestTargets returns the targets of all rules of the policies, their extensions and random targets
+func requestTargets(g *consulacltest.Generator, policies ...*consulacl.Policy) []string {
+	targets := []string{""}
+	for _, p := range policies {
+		consulacl.Walk(p, consulacl.VisitorFunc(func(rule consulacl.Rule) {
+			targets = append(targets, rule.Target, rule.Target+"x", strings.TrimSuffix(rule.Target, "/"))
+		}))
+	}
+	for i := 0; i < 10; i++ {
+		targets = append(targets, g.Target())
+	}
+	return targets
+}
+
+// assertSameDecisions checks that both policies decide all requests for the targets the same way
+func assertSameDecisions(t *testing.T, expected, actual *consulacl.Policy, targets []string) bool {
+	for _, resource := range append([]consulacl.Resource{consulacl.ResourceKeyring, consulacl.ResourceOperator}, consulacl.TargetResources...) {
+		for _, target := range targets {
+			for _, access := range propertyAccesses {
+				if expected.Allows(resource, target, access) != actual.Allows(resource, target, access) {
+					return assert.Fail(t, "decisions differ", "%s %q %s\nexpected:\n%s\nactual:\n%s",
+						resource.String(), target, access.String(), expected.GenerateRules(), actual.GenerateRules())
+				}
+			}
+		}
+	}
+	return true
+}
+
+func TestProperty_RulesRoundTrip(t *testing.T) {
+	g := consulacltest.NewGenerator(1)
+	for i := 0; i < propertyIterations; i++ {
+		p := g.Policy()
+		rules := p.GenerateRules()
+
+		parsed, err := consulacl.NewPolicyFromRules(rules)
+		require.NoError(t, err, rules)
+		require.True(t, parsed.Equals(p), rules)
+		require.EqualValues(t, rules, parsed.GenerateRules())
+	}
+}
+
+func TestProperty_CloneIsDeep(t *testing.T) {
+	g := consulacltest.NewGenerator(2)
+	for i := 0; i < propertyIterations; i++ {
+		p := g.Policy()
+		rules := p.GenerateRules()
+
+		clone := p.Clone()
+		require.True(t, clone.Equals(p))
+
+		// Modifying the clone must not affect the original and vice versa
+		clone.Merge(g.Policy())
+		clone.SetGrant(consulacl.ResourceKey, g.Target(), consulacl.GrantWrite)
+		clone.SetOperator(consulacl.GrantDeny)
+		require.EqualValues(t, rules, p.GenerateRules())
+
+		cloneRules := clone.GenerateRules()
+		p.SetGrant(consulacl.ResourceService, g.Target(), consulacl.GrantRead)
+		require.EqualValues(t, cloneRules, clone.GenerateRules())
+	}
+}
+
+func TestProperty_MergeOverrides(t *testing.T) {
+	g := consulacltest.NewGenerator(3)
+	for i := 0; i < propertyIterations; i++ {
+		base, other := g.Policy(), g.Policy()
+		merged := base.Clone()
+		merged.Merge(other)
+
+		// Every rule of the other policy wins, all remaining rules come from the base policy
+		consulacl.Walk(merged, consulacl.VisitorFunc(func(rule consulacl.Rule) {
+			expected := other.GetGrant(rule.Resource, rule.Target)
+			if expected == consulacl.GrantNone {
+				expected = base.GetGrant(rule.Resource, rule.Target)
+			}
+			assert.EqualValues(t, expected, rule.Grant, rule.String())
+		}))
+		consulacl.Walk(other, consulacl.VisitorFunc(func(rule consulacl.Rule) {
+			assert.EqualValues(t, rule.Grant, merged.GetGrant(rule.Resource, rule.Target), rule.String())
+		}))
+
+		// Merging into an empty policy yields the other policy
+		empty := consulacl.NewPolicy()
+		empty.Merge(other)
+		require.True(t, empty.Equals(other))
+	}
+}
+
+func TestProperty_NormalizePreservesSemantics(t *testing.T) {
+	g := consulacltest.NewGenerator(4)
+	for i := 0; i < propertyIterations; i++ {
+		p := g.Policy()
+		normalized := p.Normalize()
+
+		if !assertSameDecisions(t, p, normalized, requestTargets(g, p)) {
+			return
+		}
+		require.EqualValues(t, p.SemanticFingerprint(), normalized.Fingerprint())
+		require.True(t, normalized.Normalize().Equals(normalized))
+	}
+}
+
+func TestProperty_CompilePreservesSemantics(t *testing.T) {
+	g := consulacltest.NewGenerator(5)
+	for i := 0; i < propertyIterations; i++ {
+		p := g.Policy()
+		compiled := p.Compile()
+
+		for _, resource := range append([]consulacl.Resource{consulacl.ResourceKeyring, consulacl.ResourceOperator}, consulacl.TargetResources...) {
+			for _, target := range requestTargets(g, p) {
+				for _, access := range propertyAccesses {
+					require.EqualValues(t, p.Evaluate(resource, target, access), compiled.Evaluate(resource, target, access))
+				}
+			}
+		}
+	}
+}
+
+func TestProperty_Merge3(t *testing.T) {
+	g := consulacltest.NewGenerator(6)
+	for i := 0; i < propertyIterations; i++ {
+		base, theirs := g.Policy(), g.Policy()
+
+		// Without changes on our side their changes are taken over completely
+		merged, conflicts := consulacl.Merge3(base, base, theirs)
+		require.Empty(t, conflicts)
+		require.True(t, merged.Equals(theirs))
+
+		merged, conflicts = consulacl.Merge3(base, theirs, theirs)
+		require.Empty(t, conflicts)
+		require.True(t, merged.Equals(theirs))
+	}
+}
+
+func TestProperty_Diff(t *testing.T) {
+	g := consulacltest.NewGenerator(7)
+	for i := 0; i < propertyIterations; i++ {
+		from, to := g.Policy(), g.Policy()
+
+		// Applying the changes to the from policy yields the to policy
+		applied := from.Clone()
+		for _, change := range consulacl.Diff(from, to) {
+			applied.SetGrant(change.Resource, change.Target, change.New)
+		}
+		require.True(t, applied.Equals(to))
+		require.Empty(t, consulacl.Diff(to, applied))
+	}
+}
@@ -0,0 +1,253 @@
+package consulacl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ReplaySampleSize defines how many sample requests are kept per denying rule
+const ReplaySampleSize = 5
+
+// ErrUnresolvableRequest is returned if a recorded HTTP request cannot be mapped to a resource
+var ErrUnresolvableRequest = errors.New("request cannot be mapped to a resource")
+
+// ReplayRequest defines a single recorded request
+//
+// A request is either described by its HTTP method and path or directly by its resource,
+// target and access. If a resource is set the method and path are ignored.
+type ReplayRequest struct {
+	Method   string `json:"method,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Access   string `json:"access,omitempty"`
+}
+
+// Resolve maps the recorded request to a resource, target and access
+func (r ReplayRequest) Resolve() (Resource, string, Access, error) {
+	if r.Resource == "" {
+		return ResolveHTTPRequest(r.Method, r.Path)
+	}
+
+	resource := ResourceByName(r.Resource)
+	if resource == ResourceNone {
+		return ResourceNone, "", AccessNone, fmt.Errorf("invalid resource: %q", r.Resource)
+	}
+	access := AccessByName(r.Access)
+	if access == AccessNone {
+		return ResourceNone, "", AccessNone, fmt.Errorf("invalid access: %q", r.Access)
+	}
+	return resource, r.Target, access, nil
+}
+
+// ResolveHTTPRequest maps an HTTP request against the consul API to a resource, target and access
+//
+// Only endpoints whose target can be derived from the path are supported. ErrUnresolvableRequest
+// is returned for all other requests.
+func ResolveHTTPRequest(method, path string) (Resource, string, Access, error) {
+	var query string
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+	write := method != http.MethodGet && method != http.MethodHead
+
+	readOrWrite := AccessRead
+	if write {
+		readOrWrite = AccessWrite
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/v1/kv/"):
+		access := readOrWrite
+		if !write && hasQueryParameter(query, "keys") {
+			access = AccessList
+		}
+		return ResourceKey, strings.TrimPrefix(path, "/v1/kv/"), access, nil
+	case !write && strings.HasPrefix(path, "/v1/catalog/service/"):
+		return ResourceService, strings.TrimPrefix(path, "/v1/catalog/service/"), AccessRead, nil
+	case !write && strings.HasPrefix(path, "/v1/health/service/"):
+		return ResourceService, strings.TrimPrefix(path, "/v1/health/service/"), AccessRead, nil
+	case !write && strings.HasPrefix(path, "/v1/health/checks/"):
+		return ResourceService, strings.TrimPrefix(path, "/v1/health/checks/"), AccessRead, nil
+	case !write && strings.HasPrefix(path, "/v1/catalog/node/"):
+		return ResourceNode, strings.TrimPrefix(path, "/v1/catalog/node/"), AccessRead, nil
+	case !write && strings.HasPrefix(path, "/v1/health/node/"):
+		return ResourceNode, strings.TrimPrefix(path, "/v1/health/node/"), AccessRead, nil
+	case write && strings.HasPrefix(path, "/v1/event/fire/"):
+		return ResourceEvent, strings.TrimPrefix(path, "/v1/event/fire/"), AccessWrite, nil
+	case !write && strings.HasPrefix(path, "/v1/session/node/"):
+		return ResourceSession, strings.TrimPrefix(path, "/v1/session/node/"), AccessRead, nil
+	case path == "/v1/operator/keyring":
+		return ResourceKeyring, "", readOrWrite, nil
+	case strings.HasPrefix(path, "/v1/operator/"):
+		return ResourceOperator, "", readOrWrite, nil
+	}
+
+	return ResourceNone, "", AccessNone, ErrUnresolvableRequest
+}
+
+func hasQueryParameter(query, name string) bool {
+	for _, parameter := range strings.Split(query, "&") {
+		if parameter == name || strings.HasPrefix(parameter, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayDenial groups the requests denied by a single rule
+type ReplayDenial struct {
+	// Rule is the rule which denied the requests, see Decision.Rule
+	Rule string
+	// Count is the number of denied requests
+	Count int
+	// Samples holds up to ReplaySampleSize denied requests
+	Samples []ReplayRequest
+}
+
+// ReplayUnresolved groups the requests which could not be mapped to a resource for the same reason
+type ReplayUnresolved struct {
+	// Reason is the error returned by ReplayRequest.Resolve
+	Reason string
+	// Count is the number of unresolved requests
+	Count int
+	// Samples holds up to ReplaySampleSize unresolved requests
+	Samples []ReplayRequest
+}
+
+// ReplayReport holds the result of replaying recorded requests against a policy
+type ReplayReport struct {
+	// Total is the number of replayed requests
+	Total int
+	// Allowed is the number of allowed requests
+	Allowed int
+	// Denied is the number of denied requests
+	Denied int
+	// Unresolved is the number of requests which could not be mapped to a resource
+	Unresolved int
+	// Denials holds the denied requests grouped by rule, sorted by count in descending order
+	Denials []*ReplayDenial
+	// Unresolvable holds the unresolved requests grouped by reason, sorted by count in descending order
+	Unresolvable []*ReplayUnresolved
+}
+
+// replayAccumulator evaluates requests one by one and collects the results
+type replayAccumulator struct {
+	policy       *Policy
+	report       *ReplayReport
+	denials      map[string]*ReplayDenial
+	unresolvable map[string]*ReplayUnresolved
+}
+
+func newReplayAccumulator(p *Policy) *replayAccumulator {
+	return &replayAccumulator{
+		policy:       p,
+		report:       &ReplayReport{},
+		denials:      make(map[string]*ReplayDenial),
+		unresolvable: make(map[string]*ReplayUnresolved),
+	}
+}
+
+func (a *replayAccumulator) add(request ReplayRequest) {
+	a.report.Total++
+	resource, target, access, err := request.Resolve()
+	if err != nil {
+		a.report.Unresolved++
+		reason := err.Error()
+		unresolved, exists := a.unresolvable[reason]
+		if !exists {
+			unresolved = &ReplayUnresolved{Reason: reason}
+			a.unresolvable[reason] = unresolved
+			a.report.Unresolvable = append(a.report.Unresolvable, unresolved)
+		}
+		unresolved.Count++
+		if len(unresolved.Samples) < ReplaySampleSize {
+			unresolved.Samples = append(unresolved.Samples, request)
+		}
+		return
+	}
+
+	d := a.policy.Evaluate(resource, target, access)
+	if d.Allowed {
+		a.report.Allowed++
+		return
+	}
+
+	a.report.Denied++
+	rule := d.Rule()
+	denial, exists := a.denials[rule]
+	if !exists {
+		denial = &ReplayDenial{Rule: rule}
+		a.denials[rule] = denial
+		a.report.Denials = append(a.report.Denials, denial)
+	}
+	denial.Count++
+	if len(denial.Samples) < ReplaySampleSize {
+		denial.Samples = append(denial.Samples, request)
+	}
+}
+
+func (a *replayAccumulator) finish() *ReplayReport {
+	// Sort by count first and by rule or reason second to get a reproducible output
+	denials := a.report.Denials
+	sort.SliceStable(denials, func(i, j int) bool {
+		if denials[i].Count != denials[j].Count {
+			return denials[i].Count > denials[j].Count
+		}
+		return denials[i].Rule < denials[j].Rule
+	})
+	unresolvable := a.report.Unresolvable
+	sort.SliceStable(unresolvable, func(i, j int) bool {
+		if unresolvable[i].Count != unresolvable[j].Count {
+			return unresolvable[i].Count > unresolvable[j].Count
+		}
+		return unresolvable[i].Reason < unresolvable[j].Reason
+	})
+
+	return a.report
+}
+
+// Replay evaluates the given requests against the policy
+func (p *Policy) Replay(requests []ReplayRequest) *ReplayReport {
+	a := newReplayAccumulator(p)
+	for _, request := range requests {
+		a.add(request)
+	}
+	return a.finish()
+}
+
+// ReplayLog evaluates requests read from r as JSON lines against the policy
+//
+// Each line is evaluated as soon as it is read, so the log is never held in memory.
+// Empty lines are skipped. A line which cannot be decoded aborts the replay.
+func (p *Policy) ReplayLog(r io.Reader) (*ReplayReport, error) {
+	a := newReplayAccumulator(p)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var request ReplayRequest
+		if err := json.Unmarshal([]byte(text), &request); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		a.add(request)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.finish(), nil
+}
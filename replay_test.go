@@ -0,0 +1,153 @@
+package consulacl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveHTTPRequest(t *testing.T) {
+	testCases := []struct {
+		method   string
+		path     string
+		resource Resource
+		target   string
+		access   Access
+	}{
+		{"GET", "/v1/kv/app/config", ResourceKey, "app/config", AccessRead},
+		{"GET", "/v1/kv/app/?keys&separator=/", ResourceKey, "app/", AccessList},
+		{"PUT", "/v1/kv/app/config?cas=1", ResourceKey, "app/config", AccessWrite},
+		{"DELETE", "/v1/kv/app/?recurse", ResourceKey, "app/", AccessWrite},
+		{"GET", "/v1/catalog/service/web", ResourceService, "web", AccessRead},
+		{"GET", "/v1/health/service/web?passing", ResourceService, "web", AccessRead},
+		{"GET", "/v1/health/checks/web", ResourceService, "web", AccessRead},
+		{"GET", "/v1/catalog/node/node0", ResourceNode, "node0", AccessRead},
+		{"GET", "/v1/health/node/node0", ResourceNode, "node0", AccessRead},
+		{"PUT", "/v1/event/fire/deploy", ResourceEvent, "deploy", AccessWrite},
+		{"GET", "/v1/session/node/node0", ResourceSession, "node0", AccessRead},
+		{"GET", "/v1/operator/keyring", ResourceKeyring, "", AccessRead},
+		{"POST", "/v1/operator/keyring", ResourceKeyring, "", AccessWrite},
+		{"GET", "/v1/operator/raft/configuration", ResourceOperator, "", AccessRead},
+		{"DELETE", "/v1/operator/raft/peer", ResourceOperator, "", AccessWrite},
+	}
+
+	for _, tc := range testCases {
+		resource, target, access, err := ResolveHTTPRequest(tc.method, tc.path)
+		require.NoError(t, err, "%s %s", tc.method, tc.path)
+		assert.EqualValues(t, tc.resource, resource, "%s %s", tc.method, tc.path)
+		assert.EqualValues(t, tc.target, target, "%s %s", tc.method, tc.path)
+		assert.EqualValues(t, tc.access, access, "%s %s", tc.method, tc.path)
+	}
+
+	_, _, _, err := ResolveHTTPRequest("PUT", "/v1/session/create")
+	assert.EqualError(t, err, ErrUnresolvableRequest.Error())
+}
+
+func TestReplayRequest_Resolve(t *testing.T) {
+	t.Run("Explicit", func(t *testing.T) {
+		resource, target, access, err := ReplayRequest{
+			Method:   "GET",
+			Path:     "/v1/kv/ignored",
+			Resource: "service",
+			Target:   "web",
+			Access:   "write",
+		}.Resolve()
+		require.NoError(t, err)
+		assert.EqualValues(t, ResourceService, resource)
+		assert.EqualValues(t, "web", target)
+		assert.EqualValues(t, AccessWrite, access)
+	})
+
+	t.Run("InvalidResource", func(t *testing.T) {
+		_, _, _, err := ReplayRequest{Resource: "invalid", Access: "read"}.Resolve()
+		assert.EqualError(t, err, `invalid resource: "invalid"`)
+	})
+
+	t.Run("InvalidAccess", func(t *testing.T) {
+		_, _, _, err := ReplayRequest{Resource: "key", Access: "invalid"}.Resolve()
+		assert.EqualError(t, err, `invalid access: "invalid"`)
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		resource, target, access, err := ReplayRequest{Method: "GET", Path: "/v1/kv/test"}.Resolve()
+		require.NoError(t, err)
+		assert.EqualValues(t, ResourceKey, resource)
+		assert.EqualValues(t, "test", target)
+		assert.EqualValues(t, AccessRead, access)
+	})
+}
+
+func TestPolicy_ReplayLog(t *testing.T) {
+	p := NewPolicy()
+	p.Key().Set("app/", GrantRead)
+	p.Key().Set("app/secret", GrantDeny)
+	p.Service().Set("web", GrantRead)
+
+	t.Run("OK", func(t *testing.T) {
+		log := `{"method": "GET", "path": "/v1/kv/app/config"}
+{"method": "PUT", "path": "/v1/kv/app/config"}
+{"method": "PUT", "path": "/v1/kv/app/other"}
+
+{"method": "GET", "path": "/v1/kv/app/secret/db"}
+{"resource": "service", "target": "web", "access": "read"}
+{"resource": "service", "target": "db", "access": "read"}
+{"method": "PUT", "path": "/v1/session/create"}
+`
+
+		report, err := p.ReplayLog(strings.NewReader(log))
+		require.NoError(t, err)
+		assert.EqualValues(t, 7, report.Total)
+		assert.EqualValues(t, 2, report.Allowed)
+		assert.EqualValues(t, 4, report.Denied)
+		assert.EqualValues(t, 1, report.Unresolved)
+
+		require.Len(t, report.Denials, 3)
+		assert.EqualValues(t, `key "app/" = "read"`, report.Denials[0].Rule)
+		assert.EqualValues(t, 2, report.Denials[0].Count)
+		assert.Len(t, report.Denials[0].Samples, 2)
+		assert.EqualValues(t, "<default deny>", report.Denials[1].Rule)
+		assert.EqualValues(t, 1, report.Denials[1].Count)
+		assert.EqualValues(t, `key "app/secret" = "deny"`, report.Denials[2].Rule)
+		assert.EqualValues(t, 1, report.Denials[2].Count)
+
+		require.Len(t, report.Unresolvable, 1)
+		assert.EqualValues(t, ErrUnresolvableRequest.Error(), report.Unresolvable[0].Reason)
+		assert.EqualValues(t, 1, report.Unresolvable[0].Count)
+		assert.EqualValues(t, []ReplayRequest{{Method: "PUT", Path: "/v1/session/create"}}, report.Unresolvable[0].Samples)
+	})
+
+	t.Run("UnresolvedSamples", func(t *testing.T) {
+		log := strings.Repeat(`{"method": "GET", "path": "/v1/agent/self"}`+"\n", ReplaySampleSize+1) +
+			`{"resource": "invalid", "target": "x", "access": "read"}` + "\n"
+
+		report, err := p.ReplayLog(strings.NewReader(log))
+		require.NoError(t, err)
+		assert.EqualValues(t, ReplaySampleSize+2, report.Unresolved)
+		require.Len(t, report.Unresolvable, 2)
+		assert.EqualValues(t, ErrUnresolvableRequest.Error(), report.Unresolvable[0].Reason)
+		assert.EqualValues(t, ReplaySampleSize+1, report.Unresolvable[0].Count)
+		assert.Len(t, report.Unresolvable[0].Samples, ReplaySampleSize)
+		assert.EqualValues(t, `invalid resource: "invalid"`, report.Unresolvable[1].Reason)
+		assert.EqualValues(t, 1, report.Unresolvable[1].Count)
+		assert.Len(t, report.Unresolvable[1].Samples, 1)
+	})
+
+	t.Run("Samples", func(t *testing.T) {
+		log := strings.Repeat(`{"method": "PUT", "path": "/v1/kv/app/config"}`+"\n", ReplaySampleSize+2)
+
+		report, err := p.ReplayLog(strings.NewReader(log))
+		require.NoError(t, err)
+		require.Len(t, report.Denials, 1)
+		assert.EqualValues(t, ReplaySampleSize+2, report.Denials[0].Count)
+		assert.Len(t, report.Denials[0].Samples, ReplaySampleSize)
+	})
+
+	t.Run("DecodeError", func(t *testing.T) {
+		report, err := p.ReplayLog(strings.NewReader("{}\n{invalid"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "line 2: ")
+		assert.Nil(t, report)
+	})
+}
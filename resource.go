@@ -0,0 +1,125 @@
+package consulacl
+
+// Resource defines the resource kind a rule applies to
+type Resource uint8
+
+// String returns the string representation of a resource
+func (r Resource) String() string {
+	resourceName, ok := resourceNameMap[r]
+	if !ok {
+		panic("invalid resource type")
+	}
+	return resourceName
+}
+
+// IsGlobal checks if the resource is a global resource without targets (keyring and operator)
+func (r Resource) IsGlobal() bool {
+	return r == ResourceKeyring || r == ResourceOperator
+}
+
+// ResourceByName returns the resource by its specified name
+//
+// If no resource by the given name could be found ResourceNone will be returned
+func ResourceByName(name string) Resource {
+	for r, resourceName := range resourceNameMap {
+		if resourceName == name {
+			return r
+		}
+	}
+
+	return ResourceNone
+}
+
+const (
+	// ResourceNone is fully virtual and defines that no resource is referenced
+	ResourceNone Resource = iota
+	// ResourceAgent defines agent rules
+	ResourceAgent
+	// ResourceKey defines key/value store rules
+	ResourceKey
+	// ResourceNode defines node rules
+	ResourceNode
+	// ResourceService defines service rules
+	ResourceService
+	// ResourceSession defines session rules
+	ResourceSession
+	// ResourceEvent defines user event rules
+	ResourceEvent
+	// ResourceQuery defines prepared query rules
+	ResourceQuery
+	// ResourceKeyring defines the global keyring rule
+	ResourceKeyring
+	// ResourceOperator defines the global operator rule
+	ResourceOperator
+
+	resourceMax
+)
+
+var resourceNameMap = map[Resource]string{
+	ResourceNone:     "none",
+	ResourceAgent:    "agent",
+	ResourceKey:      "key",
+	ResourceNode:     "node",
+	ResourceService:  "service",
+	ResourceSession:  "session",
+	ResourceEvent:    "event",
+	ResourceQuery:    "query",
+	ResourceKeyring:  "keyring",
+	ResourceOperator: "operator",
+}
+
+// TargetResources lists all resources which hold per-target grants in a GrantMap
+var TargetResources = []Resource{
+	ResourceAgent,
+	ResourceEvent,
+	ResourceKey,
+	ResourceNode,
+	ResourceQuery,
+	ResourceService,
+	ResourceSession,
+}
+
+// Access defines the kind of access requested for a resource
+type Access uint8
+
+// String returns the string representation of an access type
+func (a Access) String() string {
+	accessName, ok := accessNameMap[a]
+	if !ok {
+		panic("invalid access type")
+	}
+	return accessName
+}
+
+// AccessByName returns the access type by its specified name
+//
+// If no access type by the given name could be found AccessNone will be returned
+func AccessByName(name string) Access {
+	for a, accessName := range accessNameMap {
+		if accessName == name {
+			return a
+		}
+	}
+
+	return AccessNone
+}
+
+const (
+	// AccessNone is fully virtual and defines that no access is requested
+	AccessNone Access = iota
+	// AccessList defines that listing is requested (only distinct from AccessRead for keys)
+	AccessList
+	// AccessRead defines that read access is requested
+	AccessRead
+	// AccessWrite defines that write access is requested
+	AccessWrite
+
+	accessMax
+)
+
+var accessNameMap = map[Access]string{
+	AccessNone:  "none",
+	AccessList:  "list",
+	AccessRead:  "read",
+	AccessWrite: "write",
+}
@@ -0,0 +1,60 @@
+package consulacl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResource_String(t *testing.T) {
+	t.Run("ValidResources", func(t *testing.T) {
+		for r, resourceName := range resourceNameMap {
+			assert.EqualValues(t, resourceName, r.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.PanicsWithValue(t, "invalid resource type", func() {
+			_ = Resource(resourceMax).String()
+		})
+	})
+}
+
+func TestResource_IsGlobal(t *testing.T) {
+	assert.True(t, ResourceKeyring.IsGlobal())
+	assert.True(t, ResourceOperator.IsGlobal())
+
+	for _, r := range TargetResources {
+		assert.False(t, r.IsGlobal())
+	}
+}
+
+func TestResourceByName(t *testing.T) {
+	assert.EqualValues(t, ResourceNone, ResourceByName("invalid"))
+
+	for expectedResource, name := range resourceNameMap {
+		assert.EqualValues(t, expectedResource, ResourceByName(name))
+	}
+}
+
+func TestAccess_String(t *testing.T) {
+	t.Run("ValidAccess", func(t *testing.T) {
+		for a, accessName := range accessNameMap {
+			assert.EqualValues(t, accessName, a.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.PanicsWithValue(t, "invalid access type", func() {
+			_ = Access(accessMax).String()
+		})
+	})
+}
+
+func TestAccessByName(t *testing.T) {
+	assert.EqualValues(t, AccessNone, AccessByName("invalid"))
+
+	for expectedAccess, name := range accessNameMap {
+		assert.EqualValues(t, expectedAccess, AccessByName(name))
+	}
+}
@@ -0,0 +1,229 @@
+package consulacl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// RotationState defines the state of a token rotation
+type RotationState uint8
+
+// String returns the string representation of a rotation state
+func (s RotationState) String() string {
+	stateName, ok := rotationStateNameMap[s]
+	if !ok {
+		panic("invalid rotation state")
+	}
+	return stateName
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s RotationState) MarshalText() ([]byte, error) {
+	stateName, ok := rotationStateNameMap[s]
+	if !ok {
+		return nil, fmt.Errorf("invalid rotation state %d", s)
+	}
+	return []byte(stateName), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *RotationState) UnmarshalText(text []byte) error {
+	for state, stateName := range rotationStateNameMap {
+		if stateName == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid rotation state %q", string(text))
+}
+
+const (
+	// RotationPending defines that the token has not been cloned yet
+	RotationPending RotationState = iota
+	// RotationCloned defines that the token has been cloned
+	RotationCloned
+	// RotationVerified defines that the policy of the clone has been verified
+	RotationVerified
+	// RotationCutOver defines that the cutover hook completed and the grace period is running
+	RotationCutOver
+	// RotationCompleted defines that the old token has been destroyed
+	RotationCompleted
+
+	rotationStateMax
+)
+
+var rotationStateNameMap = map[RotationState]string{
+	RotationPending:   "pending",
+	RotationCloned:    "cloned",
+	RotationVerified:  "verified",
+	RotationCutOver:   "cutover",
+	RotationCompleted: "completed",
+}
+
+// Rotation holds the persistent state of a token rotation
+type Rotation struct {
+	// OldID is the ID of the rotated token
+	OldID string `json:"old_id"`
+	// NewID is the ID of the clone, empty until the token has been cloned
+	NewID string        `json:"new_id,omitempty"`
+	State RotationState `json:"state"`
+	// CutoverAt is the time the cutover hook completed, nil until the cutover
+	CutoverAt *time.Time `json:"cutover_at,omitempty"`
+}
+
+// CutoverFunc defines the function type of cutover hooks
+//
+// The hook switches all consumers of the old token to the new one, e.g. by redeploying them. It may be
+// called again for the same rotation if a previous call failed or was interrupted.
+type CutoverFunc func(ctx context.Context, oldID, newID string) error
+
+// Rotator rotates tokens by cloning them, running a cutover hook and destroying the old token after a
+// grace period
+type Rotator struct {
+	// GracePeriod defines how long the old token is kept after the cutover
+	GracePeriod time.Duration
+	// Save persists the rotation after every state transition, if set
+	Save func(r *Rotation) error
+
+	acl     *api.ACL
+	cutover CutoverFunc
+}
+
+// NewRotator constructs a new rotator using the given ACL client and cutover hook
+func NewRotator(acl *api.ACL, cutover CutoverFunc) *Rotator {
+	return &Rotator{
+		acl:     acl,
+		cutover: cutover,
+	}
+}
+
+// Rotate rotates the token with the given ID, see Resume
+func (r *Rotator) Rotate(ctx context.Context, id string) (*Rotation, error) {
+	return r.Resume(ctx, &Rotation{OldID: id})
+}
+
+// Resume continues a rotation from its current state until it is completed
+//
+// The rotation is saved after every state transition, so an interrupted rotation can be resumed using
+// the last saved state. If the process stops between cloning the token and saving the state, a stray
+// clone remains. The returned rotation holds the state reached, also if an error occurred.
+func (r *Rotator) Resume(ctx context.Context, rotation *Rotation) (*Rotation, error) {
+	rot := *rotation
+
+	for rot.State != RotationCompleted {
+		if err := ctx.Err(); err != nil {
+			return &rot, err
+		}
+
+		var err error
+		switch rot.State {
+		case RotationPending:
+			if rot.NewID, _, err = r.acl.Clone(rot.OldID, nil); err == nil {
+				rot.State = RotationCloned
+			}
+		case RotationCloned:
+			if err = r.verify(&rot); err == nil {
+				rot.State = RotationVerified
+			}
+		case RotationVerified:
+			if err = r.cutover(ctx, rot.OldID, rot.NewID); err == nil {
+				now := time.Now().UTC()
+				rot.State, rot.CutoverAt = RotationCutOver, &now
+			}
+		case RotationCutOver:
+			if rot.CutoverAt == nil {
+				err = errors.New("missing cutover time")
+				break
+			}
+			if err = r.wait(ctx, rot.CutoverAt.Add(r.GracePeriod)); err != nil {
+				break
+			}
+			if _, err = r.acl.Destroy(rot.OldID, nil); err == nil {
+				rot.State = RotationCompleted
+			}
+		default:
+			err = fmt.Errorf("invalid rotation state %d", rot.State)
+		}
+		if err != nil {
+			return &rot, fmt.Errorf("rotation of token %q in state %s: %v", rot.OldID, rot.State.String(), err)
+		}
+
+		if r.Save != nil {
+			if err := r.Save(&rot); err != nil {
+				return &rot, err
+			}
+		}
+	}
+
+	return &rot, nil
+}
+
+// verify checks that the rules of the clone parse to a policy equal to the one of the old token
+func (r *Rotator) verify(rot *Rotation) error {
+	policies := make([]*Policy, 2)
+	for i, id := range []string{rot.OldID, rot.NewID} {
+		entry, _, err := r.acl.Info(id, nil)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("token %q not found", id)
+		}
+		if policies[i], err = NewPolicyFromRules(entry.Rules); err != nil {
+			return fmt.Errorf("token %q: %v", id, err)
+		}
+	}
+
+	if !policies[0].Equals(policies[1]) {
+		return fmt.Errorf("policy of clone %q does not match", rot.NewID)
+	}
+	return nil
+}
+
+// wait blocks until the given time or the context is done
+func (r *Rotator) wait(ctx context.Context, until time.Time) error {
+	delay := time.Until(until)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SaveRotationFile writes the rotation to the file as JSON, replacing the file atomically
+func SaveRotationFile(file string, rot *Rotation) error {
+	data, err := json.Marshal(rot)
+	if err != nil {
+		return err
+	}
+
+	// Token IDs are secrets, so the file is only readable by its owner
+	return writeFileAtomic(file, data, 0600)
+}
+
+// LoadRotationFile reads a rotation written by SaveRotationFile
+func LoadRotationFile(file string) (*Rotation, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rot := &Rotation{}
+	if err := json.Unmarshal(data, rot); err != nil {
+		return nil, err
+	}
+	return rot, nil
+}
@@ -0,0 +1,165 @@
+package consulacl_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotationState_String(t *testing.T) {
+	for state := consulacl.RotationPending; state < consulacl.RotationStateMax; state++ {
+		assert.NotEmpty(t, state.String())
+	}
+	assert.Panics(t, func() {
+		_ = consulacl.RotationStateMax.String()
+	})
+}
+
+func TestRotationState_MarshalText(t *testing.T) {
+	for state := consulacl.RotationPending; state < consulacl.RotationStateMax; state++ {
+		text, err := state.MarshalText()
+		require.NoError(t, err)
+
+		var unmarshaled consulacl.RotationState
+		require.NoError(t, unmarshaled.UnmarshalText(text))
+		assert.EqualValues(t, state, unmarshaled)
+	}
+
+	_, err := consulacl.RotationStateMax.MarshalText()
+	assert.Error(t, err)
+	var state consulacl.RotationState
+	assert.EqualError(t, state.UnmarshalText([]byte("unknown")), `invalid rotation state "unknown"`)
+}
+
+func TestRotator_Rotate(t *testing.T) {
+	server := newTestServer(&api.ACLEntry{ID: "old", Rules: `key "app/" { policy = "write" }`})
+	defer server.Close()
+
+	var cutovers [][2]string
+	r := consulacl.NewRotator(server.Client().ACL(), func(ctx context.Context, oldID, newID string) error {
+		cutovers = append(cutovers, [2]string{oldID, newID})
+		return nil
+	})
+	r.GracePeriod = 10 * time.Millisecond
+
+	var states []consulacl.RotationState
+	r.Save = func(rot *consulacl.Rotation) error {
+		states = append(states, rot.State)
+		return nil
+	}
+
+	rot, err := r.Rotate(context.Background(), "old")
+	require.NoError(t, err)
+	assert.EqualValues(t, consulacl.RotationCompleted, rot.State)
+	assert.NotEqual(t, "old", rot.NewID)
+	require.NotNil(t, rot.CutoverAt)
+	assert.False(t, rot.CutoverAt.IsZero())
+	assert.EqualValues(t, [][2]string{{"old", rot.NewID}}, cutovers)
+	assert.EqualValues(t, []consulacl.RotationState{consulacl.RotationCloned, consulacl.RotationVerified, consulacl.RotationCutOver, consulacl.RotationCompleted}, states)
+
+	assert.Nil(t, server.Token("old"))
+	assert.NotNil(t, server.Token(rot.NewID))
+}
+
+func TestRotator_Resume(t *testing.T) {
+	server := newTestServer(&api.ACLEntry{ID: "old", Rules: `key "app/" { policy = "write" }`})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "consulacl-rotation")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rotation.json")
+
+	failCutover := true
+	r := consulacl.NewRotator(server.Client().ACL(), func(ctx context.Context, oldID, newID string) error {
+		if failCutover {
+			return errors.New("deployment failed")
+		}
+		return nil
+	})
+	r.Save = func(rot *consulacl.Rotation) error {
+		return consulacl.SaveRotationFile(file, rot)
+	}
+
+	rot, err := r.Rotate(context.Background(), "old")
+	assert.EqualError(t, err, `rotation of token "old" in state verified: deployment failed`)
+	assert.EqualValues(t, consulacl.RotationVerified, rot.State)
+
+	loaded, err := consulacl.LoadRotationFile(file)
+	require.NoError(t, err)
+	assert.EqualValues(t, *rot, *loaded)
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.EqualValues(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Interrupt the grace period
+	failCutover = false
+	r.GracePeriod = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rot, err = r.Resume(ctx, loaded)
+	assert.Error(t, err)
+	assert.EqualValues(t, consulacl.RotationCutOver, rot.State)
+	assert.NotNil(t, server.Token("old"))
+
+	loaded, err = consulacl.LoadRotationFile(file)
+	require.NoError(t, err)
+	assert.EqualValues(t, consulacl.RotationCutOver, loaded.State)
+	require.NotNil(t, loaded.CutoverAt)
+	assert.True(t, rot.CutoverAt.Equal(*loaded.CutoverAt))
+
+	r.GracePeriod = 0
+	rot, err = r.Resume(context.Background(), loaded)
+	require.NoError(t, err)
+	assert.EqualValues(t, consulacl.RotationCompleted, rot.State)
+	assert.Nil(t, server.Token("old"))
+}
+
+func TestRotator_Verify(t *testing.T) {
+	server := newTestServer(
+		&api.ACLEntry{ID: "old", Rules: `key "app/" { policy = "write" }`},
+		&api.ACLEntry{ID: "clone-old", Rules: `key "app/" { policy = "read" }`},
+	)
+	defer server.Close()
+
+	r := consulacl.NewRotator(server.Client().ACL(), func(ctx context.Context, oldID, newID string) error {
+		require.FailNow(t, "cutover must not be called")
+		return nil
+	})
+
+	rot, err := r.Resume(context.Background(), &consulacl.Rotation{OldID: "old", NewID: "clone-old", State: consulacl.RotationCloned})
+	assert.EqualError(t, err, `rotation of token "old" in state cloned: policy of clone "clone-old" does not match`)
+	assert.EqualValues(t, consulacl.RotationCloned, rot.State)
+
+	_, err = r.Resume(context.Background(), &consulacl.Rotation{OldID: "old", NewID: "missing", State: consulacl.RotationCloned})
+	assert.EqualError(t, err, `rotation of token "old" in state cloned: token "missing" not found`)
+}
+
+func TestLoadRotationFile(t *testing.T) {
+	_, err := consulacl.LoadRotationFile(filepath.Join(os.TempDir(), "consulacl-rotation-missing.json"))
+	assert.Error(t, err)
+
+	data, err := json.Marshal(&consulacl.Rotation{OldID: "old", State: consulacl.RotationCloned})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"state":"cloned"`)
+	assert.NotContains(t, string(data), "cutover_at")
+
+	t.Run("MissingCutoverTime", func(t *testing.T) {
+		server := newTestServer()
+		defer server.Close()
+		r := consulacl.NewRotator(server.Client().ACL(), nil)
+
+		_, err := r.Resume(context.Background(), &consulacl.Rotation{OldID: "old", NewID: "new", State: consulacl.RotationCutOver})
+		assert.EqualError(t, err, `rotation of token "old" in state cutover: missing cutover time`)
+	})
+}
@@ -0,0 +1,81 @@
+package consulacl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrPolicyNotFound is returned if a policy does not exist in a store
+	ErrPolicyNotFound = errors.New("policy not found")
+	// ErrStoreConflict is returned if a check-and-set operation fails due to a concurrent modification
+	ErrStoreConflict = errors.New("policy has been modified concurrently")
+)
+
+// StoredPolicy holds a policy retrieved from a store
+type StoredPolicy struct {
+	Name   string
+	Policy *Policy
+	// Index identifies the revision of the stored policy. It changes whenever the policy is modified and
+	// is never zero for existing policies.
+	Index uint64
+}
+
+// Store defines the interface of policy storage backends
+//
+// All implementations use check-and-set semantics for modifications: an index of zero requires the policy
+// to not exist yet, any other index has to match the index of the stored policy. ErrStoreConflict is
+// returned if the index does not match.
+type Store interface {
+	// Get retrieves the policy by its name. ErrPolicyNotFound is returned if the policy does not exist.
+	Get(name string) (*StoredPolicy, error)
+
+	// Put stores the policy under the given name and returns the new index.
+	Put(name string, p *Policy, index uint64) (uint64, error)
+
+	// Delete removes the policy by its name. An index of zero deletes the policy unconditionally.
+	Delete(name string, index uint64) error
+
+	// List retrieves the sorted names of all stored policies.
+	List() ([]string, error)
+
+	// Watch blocks until the index of the policy differs from the given index and returns the policy.
+	// ErrPolicyNotFound is returned if the policy has been removed. Watching with an index of zero waits
+	// for the policy to be created.
+	Watch(ctx context.Context, name string, index uint64) (*StoredPolicy, error)
+}
+
+// RevisionStore defines the interface of policy storage backends which also keep the revisions recorded by
+// a History
+//
+// The revisions are stored along with the policies so both are modified atomically.
+type RevisionStore interface {
+	Store
+
+	// Record stores the policy of the revision under the given name like Put, or deletes the policy if the
+	// revision holds none, and records the revision along with it. The new index is returned, zero if the
+	// policy was deleted. ErrStoreConflict is also returned if the revision number is already recorded.
+	Record(name string, rev *Revision, index uint64) (uint64, error)
+
+	// Revisions retrieves all recorded revisions of the policy, oldest first.
+	Revisions(name string) ([]*Revision, error)
+
+	// Recorded retrieves the sorted names of all policies with recorded revisions.
+	Recorded() ([]string, error)
+}
+
+// historyDir is the directory of a store holding the recorded revisions
+const historyDir = ".history"
+
+// validateStoreName checks if the name can be used for a policy in a store
+func validateStoreName(name string) error {
+	if err := validatePolicyName(name); err != nil {
+		return err
+	}
+	if name == historyDir || strings.HasPrefix(name, historyDir+"/") {
+		return fmt.Errorf("reserved policy name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package consulacl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFileStorePollInterval defines the default interval at which FileStore.Watch checks for changes
+const DefaultFileStorePollInterval = time.Second
+
+// FileStoreIndexHeader prefixes the first line of the rule files written by a FileStore, which holds the index
+// of the policy
+const FileStoreIndexHeader = "# index: "
+
+// fileStoreCounter is the name of the file holding the last index issued by a FileStore
+const fileStoreCounter = ".index"
+
+// FileStore is a Store implementation which keeps policies as rule files in a directory tree
+//
+// Policies are stored in the layout used by NewPolicySetFromDir. The index of a policy is kept in a
+// header comment of its rule file and taken from a counter stored in the directory, so it increases with
+// every write, even if identical rules are written or a deleted policy is recreated. Rule files without
+// header, e.g. written by hand, have the index 1. Revisions are stored as JSON files below the ".history"
+// directory, e.g. ".history/app/1.json". Check-and-set operations are only atomic with regard to other
+// operations of the same FileStore instance.
+type FileStore struct {
+	// PollInterval defines the interval at which Watch checks for changes
+	PollInterval time.Duration
+
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore constructs a new store using the given directory
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{
+		PollInterval: DefaultFileStorePollInterval,
+		dir:          dir,
+	}
+}
+
+func (s *FileStore) file(name string) (string, error) {
+	if err := validateStoreName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)+PolicyFileExtension), nil
+}
+
+// historyDir returns the directory holding the revisions of a policy
+func (s *FileStore) historyDir(name string) (string, error) {
+	if err := validateStoreName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, historyDir, filepath.FromSlash(name)), nil
+}
+
+// fileIndex reads the index from the header of a rule file
+func fileIndex(data []byte) (uint64, error) {
+	line := string(data)
+	if !strings.HasPrefix(line, FileStoreIndexHeader) {
+		// Index 1 is reserved for files without header, zero for policies which do not exist
+		return 1, nil
+	}
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	index, err := strconv.ParseUint(strings.TrimPrefix(line, FileStoreIndexHeader), 10, 64)
+	if err != nil || index < 2 {
+		return 0, fmt.Errorf("invalid index header %q", line)
+	}
+	return index, nil
+}
+
+// nextIndex increments the counter of the store and returns the new index. The caller has to hold the lock.
+func (s *FileStore) nextIndex() (uint64, error) {
+	file := filepath.Join(s.dir, fileStoreCounter)
+	// Issued indexes start at 2, as 1 is reserved for files without header
+	index := uint64(1)
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		index, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid index counter %q", data)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	index++
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(file, []byte(strconv.FormatUint(index, 10)+"\n"), 0644); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// read retrieves the content and index of a rule file. An index of zero is returned if the file does not exist.
+func (s *FileStore) read(name string) ([]byte, uint64, error) {
+	file, err := s.file(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	index, err := fileIndex(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", file, err)
+	}
+	return data, index, nil
+}
+
+// Get implements Store
+func (s *FileStore) Get(name string) (*StoredPolicy, error) {
+	data, index, err := s.read(name)
+	if err != nil {
+		return nil, err
+	}
+	if index == 0 {
+		return nil, ErrPolicyNotFound
+	}
+
+	p, err := NewPolicyFromRules(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &StoredPolicy{Name: name, Policy: p, Index: index}, nil
+}
+
+// check verifies the index of the policy like Put. The caller has to hold the lock.
+func (s *FileStore) check(name string, index uint64) error {
+	_, current, err := s.read(name)
+	if err != nil {
+		return err
+	}
+	if current != index {
+		return ErrStoreConflict
+	}
+	return nil
+}
+
+// write writes the rule file of the policy and returns the new index. The caller has to hold the lock.
+func (s *FileStore) write(name string, p *Policy) (uint64, error) {
+	file, err := s.file(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return 0, err
+	}
+
+	next, err := s.nextIndex()
+	if err != nil {
+		return 0, err
+	}
+
+	rules := p.GenerateRules()
+	if rules != "" {
+		rules += "\n"
+	}
+	data := []byte(FileStoreIndexHeader + strconv.FormatUint(next, 10) + "\n" + rules)
+	if err := writeFileAtomic(file, data, 0644); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// Put implements Store
+func (s *FileStore) Put(name string, p *Policy, index uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(name, index); err != nil {
+		return 0, err
+	}
+	return s.write(name, p)
+}
+
+// Delete implements Store
+func (s *FileStore) Delete(name string, index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, current, err := s.read(name)
+	if err != nil {
+		return err
+	}
+	if index != 0 && current != index {
+		return ErrStoreConflict
+	}
+	if current == 0 {
+		return nil
+	}
+
+	file, err := s.file(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// List implements Store
+func (s *FileStore) List() ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() && file == filepath.Join(s.dir, historyDir) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Ext(file) != PolicyFileExtension {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, file)
+		if err != nil {
+			return err
+		}
+		names = append(names, strings.TrimSuffix(filepath.ToSlash(rel), PolicyFileExtension))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Watch implements Store
+//
+// Changes are detected by polling the file every PollInterval.
+func (s *FileStore) Watch(ctx context.Context, name string, index uint64) (*StoredPolicy, error) {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultFileStorePollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, current, err := s.read(name)
+		if err != nil {
+			return nil, err
+		}
+		if current != index {
+			if current == 0 {
+				return nil, ErrPolicyNotFound
+			}
+			return s.Get(name)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Record implements Store
+//
+// The rule file is written before the revision. If writing the revision fails, the change is picked up
+// as part of the next revision's changes.
+func (s *FileStore) Record(name string, rev *Revision, index uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, err := s.historyDir(name)
+	if err != nil {
+		return 0, err
+	}
+	revisionFile := filepath.Join(dir, strconv.Itoa(rev.Number)+".json")
+
+	if err := s.check(name, index); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(revisionFile); err == nil {
+		return 0, ErrStoreConflict
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	var next uint64
+	if rev.Policy != nil {
+		if next, err = s.write(name, rev.Policy); err != nil {
+			return 0, err
+		}
+	} else if index != 0 {
+		file, err := s.file(name)
+		if err != nil {
+			return 0, err
+		}
+		if err := os.Remove(file); err != nil {
+			return 0, err
+		}
+	}
+
+	entry := newHistoryRevision(name, rev)
+	entry.Index = next
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(revisionFile, append(data, '\n'), 0644); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// revisionNumber returns the number of the revision stored in the file, false if it is no revision file
+func revisionNumber(file string) (int, bool) {
+	base := filepath.Base(file)
+	if filepath.Ext(base) != ".json" {
+		return 0, false
+	}
+	number, err := strconv.Atoi(strings.TrimSuffix(base, ".json"))
+	return number, err == nil
+}
+
+// Revisions implements Store
+func (s *FileStore) Revisions(name string) ([]*Revision, error) {
+	dir, err := s.historyDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var revisions []*Revision
+	for _, info := range infos {
+		if _, ok := revisionNumber(info.Name()); info.IsDir() || !ok {
+			continue
+		}
+
+		file := filepath.Join(dir, info.Name())
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entry historyRevision
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		rev, err := entry.revision()
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	return revisions, nil
+}
+
+// Recorded implements Store
+func (s *FileStore) Recorded() ([]string, error) {
+	root := filepath.Join(s.dir, historyDir)
+	recorded := make(map[string]bool)
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if _, ok := revisionNumber(file); info.IsDir() || !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		recorded[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(recorded))
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,130 @@
+package consulacl_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := consulacl.NewFileStore(dir)
+	s.PollInterval = 10 * time.Millisecond
+	testStore(t, s)
+	testRevisionStore(t, s)
+}
+
+func TestFileStore_Layout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := consulacl.NewFileStore(dir)
+	p := consulacl.NewPolicy()
+	p.Service().Set("web", consulacl.GrantRead)
+
+	index, err := s.Put("team/web", p, 0)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "team", "web.hcl"))
+	require.NoError(t, err)
+	assert.EqualValues(t, fmt.Sprintf("%s%d\n%s\n", consulacl.FileStoreIndexHeader, index, p.GenerateRules()), string(data))
+
+	// The directory can be loaded as policy set
+	set, err := consulacl.NewPolicySetFromDir(dir)
+	require.NoError(t, err)
+	assert.True(t, set.Get("team/web").Equals(p))
+
+	names, err := s.List()
+	require.NoError(t, err)
+	assert.EqualValues(t, []string{"team/web"}, names)
+}
+
+func TestFileStore_InvalidName(t *testing.T) {
+	s := consulacl.NewFileStore(os.TempDir())
+	_, err := s.Put("../test", consulacl.NewPolicy(), 0)
+	assert.EqualError(t, err, `invalid policy name "../test"`)
+	_, err = s.Get("/test")
+	assert.EqualError(t, err, `invalid policy name "/test"`)
+	_, err = s.Put(".history/test", consulacl.NewPolicy(), 0)
+	assert.EqualError(t, err, `reserved policy name ".history/test"`)
+}
+
+func TestFileStore_ListMissingDir(t *testing.T) {
+	s := consulacl.NewFileStore(filepath.Join(os.TempDir(), "consulacl-store-missing"))
+	names, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestFileStore_Index(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := consulacl.NewFileStore(dir)
+	a := consulacl.NewPolicy()
+	a.Service().Set("web", consulacl.GrantRead)
+	b := consulacl.NewPolicy()
+	b.Service().Set("web", consulacl.GrantWrite)
+
+	t.Run("WriteBack", func(t *testing.T) {
+		first, err := s.Put("web", a, 0)
+		require.NoError(t, err)
+		second, err := s.Put("web", b, first)
+		require.NoError(t, err)
+		third, err := s.Put("web", a, second)
+		require.NoError(t, err)
+		assert.True(t, first < second && second < third)
+
+		// Writing the original rules back must not revive the first index
+		_, err = s.Put("web", b, first)
+		assert.EqualError(t, err, consulacl.ErrStoreConflict.Error())
+	})
+
+	t.Run("Recreate", func(t *testing.T) {
+		sp, err := s.Get("web")
+		require.NoError(t, err)
+		require.NoError(t, s.Delete("web", sp.Index))
+
+		index, err := s.Put("web", sp.Policy, 0)
+		require.NoError(t, err)
+		assert.True(t, index > sp.Index)
+	})
+
+	t.Run("Identical", func(t *testing.T) {
+		first, err := s.Put("other", a, 0)
+		require.NoError(t, err)
+		second, err := s.Put("other", a, first)
+		require.NoError(t, err)
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("WithoutHeader", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "manual.hcl"), []byte(a.GenerateRules()), 0644))
+		sp, err := s.Get("manual")
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, sp.Index)
+		assert.True(t, sp.Policy.Equals(a))
+
+		index, err := s.Put("manual", b, 1)
+		require.NoError(t, err)
+		assert.True(t, index > 1)
+	})
+
+	t.Run("InvalidHeader", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "invalid.hcl"), []byte(consulacl.FileStoreIndexHeader+"x\n"), 0644))
+		_, err := s.Get("invalid")
+		assert.Error(t, err)
+	})
+}
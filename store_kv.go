@@ -0,0 +1,332 @@
+package consulacl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// KVStore is a Store implementation which keeps policies as rules in the consul KV store
+//
+// Every policy is stored at the key made of the prefix and the policy name. The index of a policy is
+// the ModifyIndex of its key. Revisions are stored as JSON below the ".history/" folder of the prefix,
+// e.g. "consulacl/policies/.history/app/1", and written in the same transaction as the policy.
+type KVStore struct {
+	kv     *api.KV
+	prefix string
+}
+
+// NewKVStore constructs a new store using the given KV client and key prefix, e.g. "consulacl/policies/"
+func NewKVStore(kv *api.KV, prefix string) *KVStore {
+	return &KVStore{
+		kv:     kv,
+		prefix: prefix,
+	}
+}
+
+func (s *KVStore) key(name string) (string, error) {
+	if err := validateStoreName(name); err != nil {
+		return "", err
+	}
+	return s.prefix + name, nil
+}
+
+// historyKey returns the key prefix of the revisions of a policy
+func (s *KVStore) historyKey(name string) (string, error) {
+	if err := validateStoreName(name); err != nil {
+		return "", err
+	}
+	return s.prefix + historyDir + "/" + name + "/", nil
+}
+
+func (s *KVStore) storedPolicy(name string, pair *api.KVPair) (*StoredPolicy, error) {
+	p, err := NewPolicyFromRules(string(pair.Value))
+	if err != nil {
+		return nil, err
+	}
+	return &StoredPolicy{Name: name, Policy: p, Index: pair.ModifyIndex}, nil
+}
+
+// Get implements Store
+func (s *KVStore) Get(name string) (*StoredPolicy, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+	pair, _, err := s.kv.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrPolicyNotFound
+	}
+	return s.storedPolicy(name, pair)
+}
+
+// txn runs the operations, which have to check the expected indexes of the keys. ErrStoreConflict is only
+// returned if a key does not have the expected index anymore, any other failure is passed through.
+func (s *KVStore) txn(ops api.KVTxnOps, expected map[string]uint64) (*api.KVTxnResponse, error) {
+	ok, resp, _, err := s.kv.Txn(ops, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return resp, nil
+	}
+
+	// Consul reports failed index checks like any other error, so compare the current indexes instead
+	for key, index := range expected {
+		pair, _, err := s.kv.Get(key, nil)
+		if err != nil {
+			return nil, err
+		}
+		var current uint64
+		if pair != nil {
+			current = pair.ModifyIndex
+		}
+		if current != index {
+			return nil, ErrStoreConflict
+		}
+	}
+
+	var messages []string
+	for _, txnErr := range resp.Errors {
+		messages = append(messages, txnErr.What)
+	}
+	return nil, fmt.Errorf("transaction failed: %s", strings.Join(messages, ", "))
+}
+
+// modifyIndex returns the modify index of the key in the transaction results
+func modifyIndex(resp *api.KVTxnResponse, key string) (uint64, error) {
+	for _, result := range resp.Results {
+		if result != nil && result.Key == key {
+			return result.ModifyIndex, nil
+		}
+	}
+	return 0, fmt.Errorf("transaction returned no result for key %q", key)
+}
+
+// Put implements Store
+func (s *KVStore) Put(name string, p *Policy, index uint64) (uint64, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return 0, err
+	}
+	ops := api.KVTxnOps{
+		&api.KVTxnOp{
+			Verb:  api.KVCAS,
+			Key:   key,
+			Value: []byte(p.GenerateRules()),
+			Index: index,
+		},
+	}
+
+	resp, err := s.txn(ops, map[string]uint64{key: index})
+	if err != nil {
+		return 0, err
+	}
+	return modifyIndex(resp, key)
+}
+
+// Delete implements Store
+func (s *KVStore) Delete(name string, index uint64) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		_, err := s.kv.Delete(key, nil)
+		return err
+	}
+
+	// Check the index explicitly, as delete-cas succeeds for keys which do not exist
+	ops := api.KVTxnOps{
+		&api.KVTxnOp{
+			Verb:  api.KVCheckIndex,
+			Key:   key,
+			Index: index,
+		},
+		&api.KVTxnOp{
+			Verb: api.KVDelete,
+			Key:  key,
+		},
+	}
+
+	_, err = s.txn(ops, map[string]uint64{key: index})
+	return err
+}
+
+// List implements Store
+func (s *KVStore) List() ([]string, error) {
+	keys, _, err := s.kv.Keys(s.prefix, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, s.prefix)
+		// Skip folder entries and revisions
+		if name == "" || strings.HasSuffix(name, "/") || strings.HasPrefix(name, historyDir+"/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Watch implements Store
+//
+// Changes are detected using blocking queries.
+func (s *KVStore) Watch(ctx context.Context, name string, index uint64) (*StoredPolicy, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var waitIndex uint64
+	for {
+		q := &api.QueryOptions{WaitIndex: waitIndex}
+		pair, meta, err := s.kv.Get(key, q.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+
+		if pair != nil && pair.ModifyIndex != index {
+			return s.storedPolicy(name, pair)
+		}
+		if pair == nil && index != 0 {
+			return nil, ErrPolicyNotFound
+		}
+
+		// Reset the wait index if it went backwards, e.g. after a snapshot restore
+		if meta.LastIndex < waitIndex {
+			waitIndex = 0
+		} else {
+			waitIndex = meta.LastIndex
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+	}
+}
+
+// Record implements Store
+func (s *KVStore) Record(name string, rev *Revision, index uint64) (uint64, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return 0, err
+	}
+	historyKey, err := s.historyKey(name)
+	if err != nil {
+		return 0, err
+	}
+	revisionKey := historyKey + strconv.Itoa(rev.Number)
+
+	// The index is taken from the key of the revision when reading it back
+	entry := newHistoryRevision(name, rev)
+	entry.Index = 0
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	var ops api.KVTxnOps
+	switch {
+	case rev.Policy != nil:
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVCAS, Key: key, Value: []byte(rev.Policy.GenerateRules()), Index: index})
+	case index == 0:
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: key})
+	default:
+		ops = append(ops,
+			&api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: index},
+			&api.KVTxnOp{Verb: api.KVDelete, Key: key},
+		)
+	}
+	ops = append(ops,
+		&api.KVTxnOp{Verb: api.KVCheckNotExists, Key: revisionKey},
+		&api.KVTxnOp{Verb: api.KVSet, Key: revisionKey, Value: data},
+	)
+
+	resp, err := s.txn(ops, map[string]uint64{key: index, revisionKey: 0})
+	if err != nil {
+		return 0, err
+	}
+	if rev.Policy == nil {
+		return 0, nil
+	}
+	return modifyIndex(resp, key)
+}
+
+// Revisions implements Store
+func (s *KVStore) Revisions(name string) ([]*Revision, error) {
+	historyKey, err := s.historyKey(name)
+	if err != nil {
+		return nil, err
+	}
+	pairs, _, err := s.kv.List(historyKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*Revision
+	for _, pair := range pairs {
+		// Skip the revisions of nested policies, e.g. "app/web" when listing "app"
+		if _, err := strconv.Atoi(strings.TrimPrefix(pair.Key, historyKey)); err != nil {
+			continue
+		}
+
+		var entry historyRevision
+		if err := json.Unmarshal(pair.Value, &entry); err != nil {
+			return nil, fmt.Errorf("%s: %v", pair.Key, err)
+		}
+		rev, err := entry.revision()
+		if err != nil {
+			return nil, err
+		}
+		if rev.Policy != nil {
+			rev.Index = pair.ModifyIndex
+		}
+		revisions = append(revisions, rev)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	return revisions, nil
+}
+
+// Recorded implements Store
+func (s *KVStore) Recorded() ([]string, error) {
+	prefix := s.prefix + historyDir + "/"
+	keys, _, err := s.kv.Keys(prefix, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]bool)
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if i := strings.LastIndex(name, "/"); i > 0 {
+			recorded[name[:i]] = true
+		}
+	}
+
+	names := make([]string, 0, len(recorded))
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,68 @@
+package consulacl_test
+
+import (
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/anexia-it/consulacl/consulacltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVStore(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	s := consulacl.NewKVStore(server.Client().KV(), "consulacl/policies/")
+	testStore(t, s)
+	testRevisionStore(t, s)
+}
+
+func TestKVStore_InvalidName(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	s := consulacl.NewKVStore(server.Client().KV(), "consulacl/policies/")
+
+	_, err := s.Put(".history/test", consulacl.NewPolicy(), 0)
+	assert.EqualError(t, err, `reserved policy name ".history/test"`)
+	_, err = s.Get("../test")
+	assert.EqualError(t, err, `invalid policy name "../test"`)
+}
+
+func TestKVStore_TxnError(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	s := consulacl.NewKVStore(server.Client().KV(), "consulacl/policies/")
+
+	p := consulacl.NewPolicy()
+	p.Key().Set("app/", consulacl.GrantRead)
+	index, err := s.Put("app", p, 0)
+	require.NoError(t, err)
+
+	t.Run("TooLarge", func(t *testing.T) {
+		server.MaxValueSize = 8
+		defer func() {
+			server.MaxValueSize = consulacltest.DefaultMaxValueSize
+		}()
+
+		_, err := s.Put("app", p, index)
+		require.Error(t, err)
+		assert.NotEqual(t, consulacl.ErrStoreConflict, err)
+		assert.Contains(t, err.Error(), "too large")
+
+		_, err = s.Put("app", p, index+1)
+		assert.EqualError(t, err, consulacl.ErrStoreConflict.Error())
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		server.FailNext(1)
+		_, err := s.Put("app", p, index)
+		require.Error(t, err)
+		assert.NotEqual(t, consulacl.ErrStoreConflict, err)
+
+		server.FailNext(1)
+		err = s.Delete("app", index)
+		require.Error(t, err)
+		assert.NotEqual(t, consulacl.ErrStoreConflict, err)
+	})
+}
@@ -0,0 +1,177 @@
+package consulacl
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an in-memory Store implementation
+type MemoryStore struct {
+	mu       sync.Mutex
+	index    uint64
+	policies map[string]*StoredPolicy
+	// revisions holds the recorded revisions of every policy, oldest first
+	revisions map[string][]*Revision
+	// changed is closed and replaced on every modification to wake up watchers
+	changed chan struct{}
+}
+
+// NewMemoryStore constructs a new, empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		policies:  make(map[string]*StoredPolicy),
+		revisions: make(map[string][]*Revision),
+		changed:   make(chan struct{}),
+	}
+}
+
+func (s *MemoryStore) modified() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(name string) (*StoredPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp, exists := s.policies[name]
+	if !exists {
+		return nil, ErrPolicyNotFound
+	}
+	return &StoredPolicy{Name: sp.Name, Policy: sp.Policy.Clone(), Index: sp.Index}, nil
+}
+
+// Put implements Store
+func (s *MemoryStore) Put(name string, p *Policy, index uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current uint64
+	if sp, exists := s.policies[name]; exists {
+		current = sp.Index
+	}
+	if current != index {
+		return 0, ErrStoreConflict
+	}
+
+	s.index++
+	s.policies[name] = &StoredPolicy{Name: name, Policy: p.Clone(), Index: s.index}
+	s.modified()
+	return s.index, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(name string, index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp, exists := s.policies[name]
+	if index != 0 && (!exists || sp.Index != index) {
+		return ErrStoreConflict
+	}
+	if exists {
+		delete(s.policies, name)
+		s.modified()
+	}
+	return nil
+}
+
+// List implements Store
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.policies))
+	for name := range s.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Watch implements Store
+func (s *MemoryStore) Watch(ctx context.Context, name string, index uint64) (*StoredPolicy, error) {
+	for {
+		s.mu.Lock()
+		sp, exists := s.policies[name]
+		changed := s.changed
+		s.mu.Unlock()
+
+		if exists && sp.Index != index {
+			return &StoredPolicy{Name: sp.Name, Policy: sp.Policy.Clone(), Index: sp.Index}, nil
+		}
+		if !exists && index != 0 {
+			return nil, ErrPolicyNotFound
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Record implements Store
+func (s *MemoryStore) Record(name string, rev *Revision, index uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current uint64
+	if sp, exists := s.policies[name]; exists {
+		current = sp.Index
+	}
+	if current != index {
+		return 0, ErrStoreConflict
+	}
+	for _, recorded := range s.revisions[name] {
+		if recorded.Number == rev.Number {
+			return 0, ErrStoreConflict
+		}
+	}
+
+	s.index++
+	recorded := rev.clone()
+	if rev.Policy == nil {
+		recorded.Index = 0
+		delete(s.policies, name)
+	} else {
+		recorded.Index = s.index
+		s.policies[name] = &StoredPolicy{Name: name, Policy: rev.Policy.Clone(), Index: s.index}
+	}
+
+	revisions := append(s.revisions[name], recorded)
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	s.revisions[name] = revisions
+	s.modified()
+	return recorded.Index, nil
+}
+
+// Revisions implements Store
+func (s *MemoryStore) Revisions(name string) ([]*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions := make([]*Revision, 0, len(s.revisions[name]))
+	for _, rev := range s.revisions[name] {
+		revisions = append(revisions, rev.clone())
+	}
+	return revisions, nil
+}
+
+// Recorded implements Store
+func (s *MemoryStore) Recorded() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.revisions))
+	for name := range s.revisions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,34 @@
+package consulacl_test
+
+import (
+	"testing"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := consulacl.NewMemoryStore()
+	testStore(t, s)
+	testRevisionStore(t, s)
+}
+
+func TestMemoryStore_Isolation(t *testing.T) {
+	s := consulacl.NewMemoryStore()
+	p := consulacl.NewPolicy()
+	_, err := s.Put("test", p, 0)
+	require.NoError(t, err)
+
+	// Modifying the policy after storing it must not affect the store
+	p.Key().Set("test/", consulacl.GrantWrite)
+	sp, err := s.Get("test")
+	require.NoError(t, err)
+	assert.EqualValues(t, consulacl.GrantNone, sp.Policy.Key().Get("test/"))
+
+	// Modifying a retrieved policy must not affect the store either
+	sp.Policy.SetOperator(consulacl.GrantWrite)
+	sp, err = s.Get("test")
+	require.NoError(t, err)
+	assert.EqualValues(t, consulacl.GrantNone, sp.Policy.GetOperator())
+}
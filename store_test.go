@@ -0,0 +1,213 @@
+package consulacl_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anexia-it/consulacl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStore verifies the behaviour shared by all Store implementations
+func testStore(t *testing.T, s consulacl.Store) {
+	p := consulacl.NewPolicy()
+	p.Key().Set("test/", consulacl.GrantRead)
+	p.SetOperator(consulacl.GrantRead)
+
+	t.Run("GetMissing", func(t *testing.T) {
+		sp, err := s.Get("test")
+		assert.EqualError(t, err, consulacl.ErrPolicyNotFound.Error())
+		assert.Nil(t, sp)
+	})
+
+	var index uint64
+	t.Run("Create", func(t *testing.T) {
+		var err error
+		index, err = s.Put("test", p, 0)
+		require.NoError(t, err)
+		assert.NotZero(t, index)
+
+		_, err = s.Put("test", p, 0)
+		assert.EqualError(t, err, consulacl.ErrStoreConflict.Error())
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		sp, err := s.Get("test")
+		require.NoError(t, err)
+		assert.EqualValues(t, "test", sp.Name)
+		assert.EqualValues(t, index, sp.Index)
+		assert.True(t, sp.Policy.Equals(p))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		updated := p.Clone()
+		updated.Key().Set("test/", consulacl.GrantWrite)
+
+		_, err := s.Put("test", updated, index+1)
+		assert.EqualError(t, err, consulacl.ErrStoreConflict.Error())
+
+		newIndex, err := s.Put("test", updated, index)
+		require.NoError(t, err)
+		assert.NotEqual(t, index, newIndex)
+		index = newIndex
+
+		sp, err := s.Get("test")
+		require.NoError(t, err)
+		assert.True(t, sp.Policy.Equals(updated))
+	})
+
+	t.Run("List", func(t *testing.T) {
+		_, err := s.Put("other", consulacl.NewPolicy(), 0)
+		require.NoError(t, err)
+
+		names, err := s.List()
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"other", "test"}, names)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		updated := p.Clone()
+		updated.SetKeyring(consulacl.GrantWrite)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			s.Put("test", updated, index)
+		}()
+
+		sp, err := s.Watch(ctx, "test", index)
+		require.NoError(t, err)
+		assert.NotEqual(t, index, sp.Index)
+		assert.True(t, sp.Policy.Equals(updated))
+		index = sp.Index
+	})
+
+	t.Run("WatchCancel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		sp, err := s.Watch(ctx, "test", index)
+		assert.EqualError(t, err, context.DeadlineExceeded.Error())
+		assert.Nil(t, sp)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.EqualError(t, s.Delete("test", index+1), consulacl.ErrStoreConflict.Error())
+		require.NoError(t, s.Delete("test", index))
+		assert.EqualError(t, s.Delete("test", index), consulacl.ErrStoreConflict.Error())
+
+		_, err := s.Get("test")
+		assert.EqualError(t, err, consulacl.ErrPolicyNotFound.Error())
+
+		require.NoError(t, s.Delete("other", 0))
+		require.NoError(t, s.Delete("other", 0))
+
+		names, err := s.List()
+		require.NoError(t, err)
+		assert.Empty(t, names)
+	})
+
+	t.Run("WatchDelete", func(t *testing.T) {
+		index, err := s.Put("test", p, 0)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			s.Delete("test", 0)
+		}()
+
+		sp, err := s.Watch(ctx, "test", index)
+		assert.EqualError(t, err, consulacl.ErrPolicyNotFound.Error())
+		assert.Nil(t, sp)
+	})
+}
+
+// testRevisionStore verifies the behaviour shared by all RevisionStore implementations
+func testRevisionStore(t *testing.T, s consulacl.RevisionStore) {
+	p := consulacl.NewPolicy()
+	p.Key().Set("test/", consulacl.GrantRead)
+	p.SetOperator(consulacl.GrantRead)
+
+	t.Run("Record", func(t *testing.T) {
+		created := &consulacl.Revision{
+			Number:  1,
+			Author:  "alice",
+			Time:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			Message: "initial",
+			Policy:  p,
+			Changes: consulacl.Diff(nil, p),
+		}
+		index, err := s.Record("recorded", created, 0)
+		require.NoError(t, err)
+		assert.NotZero(t, index)
+
+		sp, err := s.Get("recorded")
+		require.NoError(t, err)
+		assert.EqualValues(t, index, sp.Index)
+		assert.True(t, sp.Policy.Equals(p))
+
+		deleted := &consulacl.Revision{
+			Number:  2,
+			Author:  "bob",
+			Time:    created.Time.Add(time.Minute),
+			Changes: consulacl.Diff(p, nil),
+		}
+		_, err = s.Record("recorded", deleted, index+1)
+		assert.EqualError(t, err, consulacl.ErrStoreConflict.Error())
+		_, err = s.Record("recorded", created, index)
+		assert.EqualError(t, err, consulacl.ErrStoreConflict.Error())
+
+		deletedIndex, err := s.Record("recorded", deleted, index)
+		require.NoError(t, err)
+		assert.Zero(t, deletedIndex)
+		_, err = s.Get("recorded")
+		assert.EqualError(t, err, consulacl.ErrPolicyNotFound.Error())
+
+		revisions, err := s.Revisions("recorded")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		for i, expected := range []*consulacl.Revision{created, deleted} {
+			assert.EqualValues(t, expected.Number, revisions[i].Number)
+			assert.EqualValues(t, expected.Author, revisions[i].Author)
+			assert.True(t, expected.Time.Equal(revisions[i].Time))
+			assert.EqualValues(t, expected.Message, revisions[i].Message)
+			assert.EqualValues(t, expected.Changes, revisions[i].Changes)
+		}
+		require.NotNil(t, revisions[0].Policy)
+		assert.True(t, revisions[0].Policy.Equals(p))
+		assert.EqualValues(t, index, revisions[0].Index)
+		assert.Nil(t, revisions[1].Policy)
+		assert.Zero(t, revisions[1].Index)
+
+		revisions, err = s.Revisions("missing")
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+	})
+
+	t.Run("Recorded", func(t *testing.T) {
+		for _, name := range []string{"team", "team/app"} {
+			_, err := s.Record(name, &consulacl.Revision{Number: 1, Policy: p}, 0)
+			require.NoError(t, err)
+		}
+
+		// Revisions of nested policies are kept apart
+		revisions, err := s.Revisions("team")
+		require.NoError(t, err)
+		assert.Len(t, revisions, 1)
+
+		recorded, err := s.Recorded()
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"recorded", "team", "team/app"}, recorded)
+
+		names, err := s.List()
+		require.NoError(t, err)
+		assert.EqualValues(t, []string{"team", "team/app"}, names)
+	})
+}
@@ -0,0 +1,132 @@
+package consulacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ExpectAllow defines that a test case expects the request to be allowed
+	ExpectAllow = "allow"
+	// ExpectDeny defines that a test case expects the request to be denied
+	ExpectDeny = "deny"
+)
+
+// TestCase defines an expected decision of a policy
+//
+// Test cases are usually loaded from JSON or YAML files holding an array of cases, e.g.
+// `[{"resource": "key", "target": "app/db", "access": "write", "expect": "deny"}]` or
+// `- {resource: key, target: app/db, access: write, expect: deny}`.
+type TestCase struct {
+	// Name describes the case, optional
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Resource string `json:"resource" yaml:"resource"`
+	Target   string `json:"target,omitempty" yaml:"target,omitempty"`
+	Access   string `json:"access" yaml:"access"`
+	// Expect is either ExpectAllow or ExpectDeny
+	Expect string `json:"expect" yaml:"expect"`
+}
+
+// String returns the name of the case, or a description of the request if the name is empty
+func (c TestCase) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Target == "" {
+		return fmt.Sprintf("%s %s", c.Resource, c.Access)
+	}
+	return fmt.Sprintf("%s %q %s", c.Resource, c.Target, c.Access)
+}
+
+// Run evaluates the case against the policy
+func (c TestCase) Run(p *Policy) TestResult {
+	result := TestResult{Case: c}
+
+	resource, target, access, err := ReplayRequest{Resource: c.Resource, Target: c.Target, Access: c.Access}.Resolve()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if c.Expect != ExpectAllow && c.Expect != ExpectDeny {
+		result.Err = fmt.Errorf("invalid expectation: %q", c.Expect)
+		return result
+	}
+
+	result.Decision = p.Evaluate(resource, target, access)
+	result.Passed = result.Decision.Allowed == (c.Expect == ExpectAllow)
+	return result
+}
+
+// TestResult holds the result of running a test case
+type TestResult struct {
+	Case     TestCase
+	Decision Decision
+	Passed   bool
+	// Err holds the error if the case is invalid
+	Err error
+}
+
+// Explanation describes why the case passed or failed
+func (r TestResult) Explanation() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s: %v", r.Case.String(), r.Err)
+	}
+
+	actual := ExpectDeny
+	if r.Decision.Allowed {
+		actual = ExpectAllow
+	}
+	if r.Passed {
+		return fmt.Sprintf("%s: %s by %s", r.Case.String(), actual, r.Decision.Rule())
+	}
+	return fmt.Sprintf("%s: expected %s, got %s by %s", r.Case.String(), r.Case.Expect, actual, r.Decision.Rule())
+}
+
+// RunTestCases evaluates all cases against the policy
+func (p *Policy) RunTestCases(cases []TestCase) []TestResult {
+	results := make([]TestResult, len(cases))
+	for i, c := range cases {
+		results[i] = c.Run(p)
+	}
+	return results
+}
+
+// LoadTestCases reads an array of test cases in JSON or YAML format
+func LoadTestCases(r io.Reader) ([]TestCase, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []TestCase
+	err = json.Unmarshal(data, &cases)
+	if _, isSyntaxErr := err.(*json.SyntaxError); !isSyntaxErr {
+		return cases, err
+	}
+	// Anything which is not JSON is parsed as YAML
+	cases = nil
+	if err := yaml.Unmarshal(data, &cases); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// LoadTestCasesFile reads a JSON or YAML file holding an array of test cases
+func LoadTestCasesFile(file string) ([]TestCase, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cases, err := LoadTestCases(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return cases, nil
+}
@@ -0,0 +1,123 @@
+package consulacl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCasePolicy() *Policy {
+	p := NewPolicy()
+	p.Key().Set("app/", GrantWrite)
+	p.Key().Set("app/db", GrantRead)
+	p.SetOperator(GrantRead)
+	return p
+}
+
+func TestTestCase_String(t *testing.T) {
+	assert.EqualValues(t, "named", TestCase{Name: "named", Resource: "key"}.String())
+	assert.EqualValues(t, `key "app/db" write`, TestCase{Resource: "key", Target: "app/db", Access: "write"}.String())
+	assert.EqualValues(t, "operator read", TestCase{Resource: "operator", Access: "read"}.String())
+}
+
+func TestTestCase_Run(t *testing.T) {
+	p := testCasePolicy()
+
+	t.Run("Passed", func(t *testing.T) {
+		result := TestCase{Resource: "key", Target: "app/db", Access: "write", Expect: ExpectDeny}.Run(p)
+		require.NoError(t, result.Err)
+		assert.True(t, result.Passed)
+		assert.EqualValues(t, `key "app/db" write: deny by key "app/db" = "read"`, result.Explanation())
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		result := TestCase{Resource: "key", Target: "app/web", Access: "write", Expect: ExpectDeny}.Run(p)
+		require.NoError(t, result.Err)
+		assert.False(t, result.Passed)
+		assert.EqualValues(t, `key "app/web" write: expected deny, got allow by key "app/" = "write"`, result.Explanation())
+
+		result = TestCase{Name: "other keys", Resource: "key", Target: "other", Access: "read", Expect: ExpectAllow}.Run(p)
+		assert.False(t, result.Passed)
+		assert.EqualValues(t, `other keys: expected allow, got deny by <default deny>`, result.Explanation())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		result := TestCase{Resource: "unknown", Access: "read", Expect: ExpectDeny}.Run(p)
+		assert.False(t, result.Passed)
+		assert.EqualValues(t, `unknown read: invalid resource: "unknown"`, result.Explanation())
+
+		result = TestCase{Resource: "key", Access: "read", Expect: "maybe"}.Run(p)
+		assert.False(t, result.Passed)
+		assert.EqualError(t, result.Err, `invalid expectation: "maybe"`)
+	})
+}
+
+func TestPolicy_RunTestCases(t *testing.T) {
+	results := testCasePolicy().RunTestCases([]TestCase{
+		{Resource: "operator", Access: "read", Expect: ExpectAllow},
+		{Resource: "operator", Access: "write", Expect: ExpectAllow},
+	})
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Passed)
+	assert.False(t, results[1].Passed)
+}
+
+func TestLoadTestCases(t *testing.T) {
+	cases, err := LoadTestCases(strings.NewReader(`[{"resource": "key", "target": "app/db", "access": "write", "expect": "deny"}]`))
+	require.NoError(t, err)
+	assert.EqualValues(t, []TestCase{{Resource: "key", Target: "app/db", Access: "write", Expect: ExpectDeny}}, cases)
+
+	_, err = LoadTestCases(strings.NewReader(`{}`))
+	assert.Error(t, err)
+
+	t.Run("YAML", func(t *testing.T) {
+		cases, err := LoadTestCases(strings.NewReader(`
+- {resource: key, target: app/db, access: write, expect: deny}
+- name: operator read
+  resource: operator
+  access: read
+  expect: allow
+`))
+		require.NoError(t, err)
+		assert.EqualValues(t, []TestCase{
+			{Resource: "key", Target: "app/db", Access: "write", Expect: ExpectDeny},
+			{Name: "operator read", Resource: "operator", Access: "read", Expect: ExpectAllow},
+		}, cases)
+
+		_, err = LoadTestCases(strings.NewReader(`resource: key`))
+		assert.Error(t, err)
+		_, err = LoadTestCases(strings.NewReader(`[{resource: key`))
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadTestCasesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consulacl-cases")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "cases.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[{"resource": "operator", "access": "read", "expect": "allow"}]`), 0644))
+	cases, err := LoadTestCasesFile(file)
+	require.NoError(t, err)
+	assert.Len(t, cases, 1)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte(`[`), 0644))
+	_, err = LoadTestCasesFile(invalid)
+	assert.Contains(t, err.Error(), invalid+": ")
+
+	yamlFile := filepath.Join(dir, "cases.yaml")
+	require.NoError(t, ioutil.WriteFile(yamlFile, []byte("- resource: operator\n  access: read\n  expect: allow\n"), 0644))
+	cases, err = LoadTestCasesFile(yamlFile)
+	require.NoError(t, err)
+	assert.EqualValues(t, []TestCase{{Resource: "operator", Access: "read", Expect: ExpectAllow}}, cases)
+
+	_, err = LoadTestCasesFile(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
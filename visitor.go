@@ -0,0 +1,76 @@
+package consulacl
+
+import (
+	"fmt"
+)
+
+// Rule defines a single grant of a policy
+type Rule struct {
+	Resource Resource
+	// Target is the target of the rule. It is empty for global resources (keyring and operator).
+	Target string
+	Grant  Grant
+}
+
+// String returns the string representation of a rule
+func (r Rule) String() string {
+	if r.Resource.IsGlobal() {
+		return fmt.Sprintf(`%s = "%s"`, r.Resource.String(), r.Grant.String())
+	}
+	return fmt.Sprintf(`%s %s = "%s"`, r.Resource.String(), quoteString(r.Target), r.Grant.String())
+}
+
+// Visitor defines the interface of types visiting the rules of a policy
+type Visitor interface {
+	// Visit is called for every rule of the policy
+	Visit(rule Rule)
+}
+
+// VisitorFunc is an adapter to allow the use of ordinary functions as Visitor
+type VisitorFunc func(rule Rule)
+
+// Visit implements Visitor
+func (fn VisitorFunc) Visit(rule Rule) {
+	fn(rule)
+}
+
+// Walk calls the visitor for every rule of the policy
+//
+// The keyring and operator grants are visited first if they are set, followed by the targets of every
+// GrantMap. GrantMaps are visited in the order of TargetResources, targets in sorted order.
+func Walk(p *Policy, v Visitor) {
+	// Walk a snapshot, so the visitor may modify the policy
+	snapshot := p.Clone()
+
+	for _, resource := range []Resource{ResourceKeyring, ResourceOperator} {
+		if grant := snapshot.GetGrant(resource, ""); grant != GrantNone {
+			v.Visit(Rule{Resource: resource, Grant: grant})
+		}
+	}
+
+	for _, resource := range TargetResources {
+		gm := snapshot.grantMap(resource)
+		for _, target := range gm.Targets() {
+			v.Visit(Rule{Resource: resource, Target: target, Grant: gm.Get(target)})
+		}
+	}
+}
+
+// TransformFunc defines the function type used by Transform
+//
+// The function returns the rule to add to the new policy and whether the rule should be added at all.
+type TransformFunc func(rule Rule) (Rule, bool)
+
+// Transform builds a new policy from the rules of the policy, as returned by the transform function
+//
+// Rules are transformed in the order of Walk. If multiple rules are transformed to the same target the
+// last one wins. The source policy is not modified.
+func Transform(p *Policy, fn TransformFunc) *Policy {
+	transformed := NewPolicy()
+	Walk(p, VisitorFunc(func(rule Rule) {
+		if rule, ok := fn(rule); ok {
+			transformed.SetGrant(rule.Resource, rule.Target, rule.Grant)
+		}
+	}))
+	return transformed
+}
@@ -0,0 +1,74 @@
+package consulacl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRule_String(t *testing.T) {
+	assert.EqualValues(t, `keyring = "read"`, Rule{Resource: ResourceKeyring, Grant: GrantRead}.String())
+	assert.EqualValues(t, `key "app/" = "write"`, Rule{Resource: ResourceKey, Target: "app/", Grant: GrantWrite}.String())
+}
+
+func TestWalk(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		var rules []Rule
+		Walk(NewPolicy(), VisitorFunc(func(rule Rule) {
+			rules = append(rules, rule)
+		}))
+		assert.Empty(t, rules)
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		p := NewPolicy()
+		p.SetKeyring(GrantRead)
+		p.SetOperator(GrantWrite)
+		for _, resource := range TargetResources {
+			p.SetGrant(resource, "target1", GrantWrite)
+			p.SetGrant(resource, "target0", GrantRead)
+		}
+
+		var rules []Rule
+		Walk(p, VisitorFunc(func(rule Rule) {
+			rules = append(rules, rule)
+		}))
+
+		expected := []Rule{
+			{Resource: ResourceKeyring, Grant: GrantRead},
+			{Resource: ResourceOperator, Grant: GrantWrite},
+		}
+		for _, resource := range TargetResources {
+			expected = append(expected,
+				Rule{Resource: resource, Target: "target0", Grant: GrantRead},
+				Rule{Resource: resource, Target: "target1", Grant: GrantWrite},
+			)
+		}
+		assert.EqualValues(t, expected, rules)
+	})
+}
+
+func TestTransform(t *testing.T) {
+	p := NewPolicy()
+	p.SetOperator(GrantWrite)
+	p.Key().Set("app/", GrantWrite)
+	p.Key().Set("tmp/", GrantWrite)
+	p.Service().Set("WEB", GrantRead)
+
+	transformed := Transform(p, func(rule Rule) (Rule, bool) {
+		if rule.Resource == ResourceOperator {
+			rule.Grant = GrantRead
+		}
+		rule.Target = strings.ToLower(rule.Target)
+		return rule, rule.Target != "tmp/"
+	})
+
+	assert.EqualValues(t, GrantRead, transformed.GetOperator())
+	assert.EqualValues(t, []string{"app/"}, transformed.Key().Targets())
+	assert.EqualValues(t, []string{"web"}, transformed.Service().Targets())
+
+	// Ensure the source is unaffected
+	assert.EqualValues(t, GrantWrite, p.GetOperator())
+	assert.EqualValues(t, []string{"app/", "tmp/"}, p.Key().Targets())
+}